@@ -0,0 +1,75 @@
+package main
+
+import "context"
+
+type asyncSend struct {
+	msg  interface{}
+	done func(err error)
+}
+
+// SendAsync queues msg for sending on a background goroutine and calls done
+// (if non-nil) with the result of the write. Queued sends are written in the
+// order they were submitted. A message buffered while disconnected is only
+// reported once it has been flushed to a connection. done never runs on the
+// caller's goroutine, so it may take locks the caller holds.
+func (c *Client) SendAsync(msg interface{}, done func(err error)) {
+	c.asyncOnce.Do(func() {
+		c.asyncQueue = make(chan asyncSend, 256)
+		go c.asyncWorker()
+	})
+
+	// asyncMu keeps the stop check and the enqueue together, so the worker's
+	// final drain sees every item accepted before the client stopped.
+	item := asyncSend{msg: msg, done: done}
+	c.asyncMu.Lock()
+	defer c.asyncMu.Unlock()
+	if c.ctx.Err() != nil {
+		item.reject(ErrStopping)
+		return
+	}
+	select {
+	case c.asyncQueue <- item:
+	default:
+		item.reject(ErrBufferFull)
+	}
+}
+
+func (c *Client) asyncWorker() {
+	for {
+		select {
+		case <-c.ctx.Done():
+			c.asyncMu.Lock()
+			var stranded []asyncSend
+			for len(c.asyncQueue) > 0 {
+				stranded = append(stranded, <-c.asyncQueue)
+			}
+			c.asyncMu.Unlock()
+			for _, item := range stranded {
+				item.resolve(ErrStopping)
+			}
+			return
+		case item := <-c.asyncQueue:
+			item.resolve(c.sendAndWait(item.msg))
+		}
+	}
+}
+
+func (c *Client) sendAndWait(msg interface{}) error {
+	ticket, err := c.send(context.Background(), msg)
+	if err != nil || ticket == 0 {
+		return err
+	}
+	return c.waitFlushed(ticket)
+}
+
+// reject reports a send that never reached the queue. It runs done on its
+// own goroutine, as the worker would.
+func (a asyncSend) reject(err error) {
+	go a.resolve(err)
+}
+
+func (a asyncSend) resolve(err error) {
+	if a.done != nil {
+		a.done(err)
+	}
+}
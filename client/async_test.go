@@ -0,0 +1,151 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSendAsyncReportsWrite(t *testing.T) {
+	received := make(chan []byte, 1)
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		if _, msg, err := conn.ReadMessage(); err == nil {
+			received <- msg
+		}
+		conn.ReadMessage()
+	})
+	c := newTestClient(t, addr, nil, nil)
+	startConnected(t, c)
+
+	done := make(chan error, 1)
+	c.SendAsync("hello", func(err error) { done <- err })
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("done(%v), want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("done not called")
+	}
+	if msg := <-received; string(msg) != `"hello"` {
+		t.Fatalf("server read %s", msg)
+	}
+}
+
+func TestSendAsyncAfterStopNeverRunsDoneInline(t *testing.T) {
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) { conn.ReadMessage() })
+	c := newTestClient(t, addr, nil, nil)
+	startConnected(t, c)
+	c.Stop()
+
+	// done takes a lock the caller holds, so an inline call would deadlock.
+	var mu sync.Mutex
+	done := make(chan error, 1)
+	mu.Lock()
+	c.SendAsync("late", func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		done <- err
+	})
+	mu.Unlock()
+
+	select {
+	case err := <-done:
+		if !errors.Is(err, ErrStopping) {
+			t.Fatalf("done(%v), want ErrStopping", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("done not called")
+	}
+}
+
+func TestSendAsyncWaitsForBufferedFlush(t *testing.T) {
+	var ready atomic.Bool
+	received := make(chan []byte, 1)
+	upgrader := websocket.Upgrader{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !ready.Load() {
+			http.Error(w, "not yet", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if _, msg, err := conn.ReadMessage(); err == nil {
+			received <- msg
+		}
+		conn.ReadMessage()
+	}))
+	t.Cleanup(ts.Close)
+
+	c := newTestClient(t, ts.Listener.Addr().String(), func(cfg *ClientConfig) {
+		cfg.SendBufferSize = 4
+		cfg.RetryInterval = 20 * time.Millisecond
+		cfg.StableConnectionThreshold = 0
+	}, nil)
+	c.Start()
+
+	done := make(chan error, 1)
+	c.SendAsync("buffered", func(err error) { done <- err })
+
+	select {
+	case err := <-done:
+		t.Fatalf("done(%v) while the message was only buffered", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	ready.Store(true)
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("done(%v) after flush, want nil", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("done not called after reconnect")
+	}
+	if msg := <-received; string(msg) != `"buffered"` {
+		t.Fatalf("server read %s", msg)
+	}
+}
+
+func TestSendAsyncRacingStopCallsDoneOnce(t *testing.T) {
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+	c := newTestClient(t, addr, nil, nil)
+	startConnected(t, c)
+
+	const senders, perSender = 8, 50
+	var calls atomic.Int64
+	var wg sync.WaitGroup
+	for range senders {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range perSender {
+				c.SendAsync("x", func(error) { calls.Add(1) })
+			}
+		}()
+	}
+	go c.Stop()
+	wg.Wait()
+
+	waitFor(t, 2*time.Second, func() bool { return calls.Load() >= senders*perSender })
+	time.Sleep(50 * time.Millisecond)
+	if n := calls.Load(); n != senders*perSender {
+		t.Fatalf("done called %d times for %d sends", n, senders*perSender)
+	}
+}
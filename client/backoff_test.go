@@ -0,0 +1,175 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestShortConnectionsDoNotConsumeMaxRetries(t *testing.T) {
+	var requests atomic.Int32
+	upgrader := websocket.Upgrader{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Three connections that drop at once, one failed handshake, then a
+		// connection that stays up.
+		n := requests.Add(1)
+		if n == 4 {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		if n > 4 {
+			conn.ReadMessage()
+		}
+	}))
+	t.Cleanup(ts.Close)
+
+	c := newTestClient(t, ts.Listener.Addr().String(), func(cfg *ClientConfig) {
+		cfg.MaxRetries = 2
+		cfg.RetryInterval = time.Millisecond
+		cfg.StableConnectionThreshold = time.Hour
+	}, nil)
+	c.Start()
+
+	waitFor(t, 2*time.Second, func() bool { return requests.Load() >= 5 })
+}
+
+func TestShortConnectionsEscalateBackoff(t *testing.T) {
+	var accepted atomic.Int32
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		accepted.Add(1)
+	})
+
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.RetryInterval = 100 * time.Millisecond
+		cfg.StableConnectionThreshold = time.Hour
+	}, nil)
+	c.Start()
+
+	// Delays of 100ms, 200ms and 300ms leave room for at most three
+	// reconnects in 650ms; a backoff that reset on every connect would allow
+	// six.
+	time.Sleep(650 * time.Millisecond)
+	if n := accepted.Load(); n < 2 || n > 4 {
+		t.Fatalf("accepted %d connections in 650ms, want 2-4 with escalating backoff", n)
+	}
+}
+
+func TestRetryScheduleMatchesObservedDelays(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts []time.Time
+	)
+	c := newTestClient(t, "127.0.0.1:0", func(cfg *ClientConfig) {
+		cfg.RetryInterval = 40 * time.Millisecond
+		cfg.MaxRetries = 4
+	}, nil)
+	c.dial = func(ctx context.Context, url string, header http.Header) (wsConn, *http.Response, error) {
+		mu.Lock()
+		attempts = append(attempts, time.Now())
+		mu.Unlock()
+		return nil, nil, errors.New("refused")
+	}
+
+	schedule := c.config.RetrySchedule(10)
+	want := []time.Duration{40 * time.Millisecond, 80 * time.Millisecond, 120 * time.Millisecond}
+	if len(schedule) != len(want) {
+		t.Fatalf("RetrySchedule(10) = %v, want %v", schedule, want)
+	}
+	for i := range want {
+		if schedule[i] != want[i] {
+			t.Fatalf("RetrySchedule(10) = %v, want %v", schedule, want)
+		}
+	}
+
+	c.Start()
+	waitFor(t, 2*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(attempts) == c.config.MaxRetries
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, delay := range schedule {
+		if gap := attempts[i+1].Sub(attempts[i]); gap < delay || gap > delay+100*time.Millisecond {
+			t.Errorf("retry %d waited %v, schedule says %v", i+1, gap, delay)
+		}
+	}
+}
+
+func TestZeroMaxRetriesRetriesForever(t *testing.T) {
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) { conn.ReadMessage() })
+
+	var attempts atomic.Int32
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.MaxRetries = 0
+		cfg.RetryInterval = time.Millisecond
+	}, nil)
+	c.dial = func(ctx context.Context, url string, header http.Header) (wsConn, *http.Response, error) {
+		if attempts.Add(1) <= 5 {
+			return nil, nil, errors.New("refused")
+		}
+		return c.dialWebsocket(ctx, url, header)
+	}
+	startConnected(t, c)
+
+	if n := attempts.Load(); n != 6 {
+		t.Fatalf("connected after %d attempts, want 6", n)
+	}
+}
+
+func TestStopInterruptsInfiniteRetries(t *testing.T) {
+	c := newTestClient(t, "127.0.0.1:0", func(cfg *ClientConfig) {
+		cfg.MaxRetries = 0
+		cfg.RetryInterval = time.Hour
+	}, nil)
+	c.dial = func(ctx context.Context, url string, header http.Header) (wsConn, *http.Response, error) {
+		return nil, nil, errors.New("refused")
+	}
+	c.Start()
+	time.Sleep(20 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		c.Stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stop blocked while waiting to retry")
+	}
+}
+
+func TestRetryScheduleAfterFlaps(t *testing.T) {
+	cfg := NewClientConfig("ws", "localhost", "0", "/", "test", 0, 4)
+	cfg.RetryInterval = 10 * time.Millisecond
+
+	if got, want := cfg.RetrySchedule(10), cfg.RetryScheduleAfterFlaps(0, 10); !slices.Equal(got, want) {
+		t.Fatalf("RetrySchedule = %v, RetryScheduleAfterFlaps(0) = %v", got, want)
+	}
+	want := []time.Duration{30 * time.Millisecond, 40 * time.Millisecond, 50 * time.Millisecond}
+	if got := cfg.RetryScheduleAfterFlaps(2, 10); !slices.Equal(got, want) {
+		t.Fatalf("RetryScheduleAfterFlaps(2) = %v, want %v", got, want)
+	}
+
+	// Without a threshold every connect resets the backoff, so flaps do not
+	// shift the schedule.
+	cfg.StableConnectionThreshold = 0
+	if got := cfg.RetryScheduleAfterFlaps(2, 10); !slices.Equal(got, cfg.RetrySchedule(10)) {
+		t.Fatalf("RetryScheduleAfterFlaps(2) without a threshold = %v", got)
+	}
+}
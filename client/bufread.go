@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+)
+
+var readBufferPool = sync.Pool{
+	New: func() any {
+		return new(bytes.Buffer)
+	},
+}
+
+func (c *Client) readMessage(conn wsConn) (int, []byte, func(), error) {
+	if c.callbacks.OnMessageBuffered == nil {
+		messageType, msg, err := conn.ReadMessage()
+		return messageType, msg, func() {}, err
+	}
+
+	messageType, r, err := conn.NextReader()
+	if err != nil {
+		return messageType, nil, func() {}, err
+	}
+
+	buf := readBufferPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	release := func() {
+		readBufferPool.Put(buf)
+	}
+	if _, err := buf.ReadFrom(r); err != nil {
+		release()
+		return messageType, nil, func() {}, err
+	}
+	return messageType, buf.Bytes(), release, nil
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+func TestOnMessageBufferedReplacesOnMessage(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	messages := make(chan string, 2)
+	newFakeClient(t, conn, nil, &ClientCallbacks{
+		OnMessage: func(msg []byte) { t.Errorf("OnMessage(%q) called alongside OnMessageBuffered", msg) },
+		OnMessageBuffered: func(msg []byte) {
+			// msg is only valid during the callback.
+			messages <- string(msg)
+		},
+	})
+
+	conn.QueueRead(websocket.TextMessage, []byte("first"))
+	conn.QueueRead(websocket.TextMessage, []byte("second"))
+	for _, want := range []string{"first", "second"} {
+		select {
+		case got := <-messages:
+			if got != want {
+				t.Fatalf("OnMessageBuffered(%q), want %q", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("OnMessageBuffered not called for %q", want)
+		}
+	}
+}
+
+// BenchmarkReadMessage reads frames off a real connection with the default
+// ReadMessage path and with the pooled OnMessageBuffered path.
+func BenchmarkReadMessage(b *testing.B) {
+	payload := bytes.Repeat([]byte("x"), 4096)
+
+	for _, bc := range []struct {
+		name     string
+		buffered func(msg []byte)
+	}{
+		{"ReadMessage", nil},
+		{"Buffered", func(msg []byte) {}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			addr := newTestServer(b, nil, func(conn *websocket.Conn) {
+				for i := 0; i < b.N; i++ {
+					if err := conn.WriteMessage(websocket.BinaryMessage, payload); err != nil {
+						return
+					}
+				}
+				conn.ReadMessage()
+			})
+			conn, _, err := websocket.DefaultDialer.Dial("ws://"+addr, nil)
+			if err != nil {
+				b.Fatalf("dial: %v", err)
+			}
+			defer conn.Close()
+
+			c := &Client{callbacks: &ClientCallbacks{OnMessageBuffered: bc.buffered}}
+			b.ReportAllocs()
+			b.SetBytes(int64(len(payload)))
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				_, msg, release, err := c.readMessage(conn)
+				if err != nil {
+					b.Fatalf("read %d: %v", i, err)
+				}
+				if len(msg) != len(payload) {
+					b.Fatalf("read %d bytes, want %d", len(msg), len(payload))
+				}
+				release()
+			}
+		})
+	}
+}
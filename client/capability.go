@@ -0,0 +1,34 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/websocket"
+)
+
+const frameCapabilityHeader = "X-Frame-Capability"
+
+func (c *Client) FrameCapability() int {
+	if t := c.frameType.Load(); t != 0 {
+		return int(t)
+	}
+	return websocket.TextMessage
+}
+
+func (c *Client) negotiateFrameType(resp *http.Response) {
+	frameType := websocket.TextMessage
+	if !c.config.PreferText && resp != nil && supportsBinary(resp.Header.Get(frameCapabilityHeader)) {
+		frameType = websocket.BinaryMessage
+	}
+	c.frameType.Store(int32(frameType))
+}
+
+func supportsBinary(capability string) bool {
+	for _, kind := range strings.Split(capability, ",") {
+		if strings.EqualFold(strings.TrimSpace(kind), "binary") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestFrameTypeNegotiation(t *testing.T) {
+	tests := []struct {
+		name       string
+		capability string
+		preferText bool
+		want       int
+	}{
+		{"server offers binary", "text, binary", false, websocket.BinaryMessage},
+		{"prefer text", "text, binary", true, websocket.TextMessage},
+		{"text only server", "text", false, websocket.TextMessage},
+		{"no capability header", "", false, websocket.TextMessage},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			header := http.Header{}
+			if tt.capability != "" {
+				header.Set(frameCapabilityHeader, tt.capability)
+			}
+			received := make(chan int, 1)
+			addr := newTestServer(t, header, func(conn *websocket.Conn) {
+				messageType, _, err := conn.ReadMessage()
+				if err == nil {
+					received <- messageType
+				}
+			})
+
+			c := newTestClient(t, addr, func(cfg *ClientConfig) {
+				cfg.PreferText = tt.preferText
+			}, nil)
+			startConnected(t, c)
+
+			if got := c.FrameCapability(); got != tt.want {
+				t.Fatalf("FrameCapability() = %d, want %d", got, tt.want)
+			}
+			if err := c.Send("hi"); err != nil {
+				t.Fatalf("Send: %v", err)
+			}
+			select {
+			case got := <-received:
+				if got != tt.want {
+					t.Fatalf("server read frame type %d, want %d", got, tt.want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("server read nothing")
+			}
+		})
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+	"time"
+)
+
+const (
+	captureOutbound byte = iota
+	captureInbound
+)
+
+type CaptureFrame struct {
+	Inbound     bool
+	MessageType int
+	Time        time.Time
+	Data        []byte
+}
+
+// StartCapture records every inbound and outbound data frame to w. Each
+// record is: direction (1 byte), message type (1 byte), unix-nano timestamp
+// (8 bytes), payload length (4 bytes), payload; all integers big-endian.
+func (c *Client) StartCapture(w io.Writer) {
+	c.captureMu.Lock()
+	defer c.captureMu.Unlock()
+	c.capture = w
+}
+
+func (c *Client) StopCapture() {
+	c.captureMu.Lock()
+	defer c.captureMu.Unlock()
+	c.capture = nil
+}
+
+func (c *Client) captureFrame(direction byte, messageType int, data []byte) {
+	c.captureMu.Lock()
+	defer c.captureMu.Unlock()
+	if c.capture == nil {
+		return
+	}
+
+	var header [14]byte
+	header[0] = direction
+	header[1] = byte(messageType)
+	binary.BigEndian.PutUint64(header[2:10], uint64(time.Now().UnixNano()))
+	binary.BigEndian.PutUint32(header[10:14], uint32(len(data)))
+
+	if _, err := c.capture.Write(header[:]); err == nil {
+		_, err = c.capture.Write(data)
+		if err == nil {
+			return
+		}
+	}
+	c.logger.Warnf("Capture write failed, stopping capture")
+	c.capture = nil
+}
+
+func ReplayCapture(r io.Reader, handler func(frame CaptureFrame)) error {
+	var header [14]byte
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+
+		data := make([]byte, binary.BigEndian.Uint32(header[10:14]))
+		if _, err := io.ReadFull(r, data); err != nil {
+			return err
+		}
+
+		handler(CaptureFrame{
+			Inbound:     header[0] == captureInbound,
+			MessageType: int(header[1]),
+			Time:        time.Unix(0, int64(binary.BigEndian.Uint64(header[2:10]))),
+			Data:        data,
+		})
+	}
+}
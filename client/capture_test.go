@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+func TestCaptureRoundTrip(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	received := make(chan struct{}, 1)
+	c := newFakeClient(t, conn, nil, &ClientCallbacks{
+		OnMessage: func(msg []byte) { received <- struct{}{} },
+	})
+
+	var capture bytes.Buffer
+	before := time.Now()
+	c.StartCapture(&capture)
+	if err := c.Send("out"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	conn.QueueRead(websocket.BinaryMessage, []byte{0x00, 0xff})
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("inbound frame not delivered")
+	}
+	c.StopCapture()
+	c.Send("not captured")
+
+	var frames []CaptureFrame
+	if err := ReplayCapture(bytes.NewReader(capture.Bytes()), func(f CaptureFrame) {
+		frames = append(frames, f)
+	}); err != nil {
+		t.Fatalf("ReplayCapture: %v", err)
+	}
+
+	want := []CaptureFrame{
+		{Inbound: false, MessageType: websocket.TextMessage, Data: []byte(`"out"`)},
+		{Inbound: true, MessageType: websocket.BinaryMessage, Data: []byte{0x00, 0xff}},
+	}
+	if len(frames) != len(want) {
+		t.Fatalf("replayed %d frames, want %d", len(frames), len(want))
+	}
+	for i, f := range frames {
+		if f.Inbound != want[i].Inbound || f.MessageType != want[i].MessageType || !bytes.Equal(f.Data, want[i].Data) {
+			t.Errorf("frame %d = %+v, want %+v", i, f, want[i])
+		}
+		if f.Time.Before(before) || f.Time.After(time.Now()) {
+			t.Errorf("frame %d timestamp %v out of range", i, f.Time)
+		}
+	}
+}
+
+func TestReplayCaptureTruncated(t *testing.T) {
+	c := &Client{logger: discardLogger()}
+	var capture bytes.Buffer
+	c.StartCapture(&capture)
+	c.captureFrame(captureInbound, websocket.TextMessage, []byte("hello"))
+
+	truncated := capture.Bytes()[:capture.Len()-1]
+	err := ReplayCapture(bytes.NewReader(truncated), func(CaptureFrame) {})
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("ReplayCapture of a truncated capture = %v, want io.ErrUnexpectedEOF", err)
+	}
+}
@@ -2,32 +2,140 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
 )
 
+var (
+	ErrDeadConnection = errors.New("websocket client: connection dead")
+	ErrDialTimeout    = errors.New("websocket client: dial timed out")
+)
+
 type ClientConfig struct {
 	Scheme  string
 	Host    string
 	Port    string
 	Path    string
 	Headers http.Header
-
+	Query   url.Values
+
+	// Endpoints lists full URLs tried in rotation on each (re)connect. When
+	// empty, Scheme/Host/Port/Path form the single endpoint.
+	Endpoints []string
+
+	HeadersFunc func() http.Header
+	Proxy       func(*http.Request) (*url.URL, error)
+
+	// NetDial replaces the TCP dial, e.g. to reach a server on a Unix
+	// socket. The URL host is still sent in the handshake.
+	NetDial func(network, addr string) (net.Conn, error)
+
+	// ReconnectOnMessage drops the connection and reconnects when it returns
+	// true. With HMACSecret set it only sees messages that passed
+	// verification, and is given the verified payload.
+	ReconnectOnMessage func(msg []byte) bool
+	BeforeReconnect    func(attempt int) error
+
+	// MaxReadMessageSize is the hard ceiling on one inbound message; larger
+	// messages close the connection. ReadBufferSize only sizes the socket
+	// read buffer: larger values mean fewer syscalls for big messages, smaller
+	// ones less memory per connection. It does not limit message size. Zero
+	// uses the gorilla default.
 	MaxReadMessageSize int
+	ReadBufferSize     int
 
 	ReadTimeout      time.Duration
 	WriteTimeout     time.Duration
 	HandshakeTimeout time.Duration
 
+	// DialTimeout bounds the whole dial, including DNS and TCP connect, and
+	// fails with ErrDialTimeout. HandshakeTimeout only covers the upgrade.
+	DialTimeout time.Duration
+
+	// DeadConnectionTimeout > 0 drops the connection and reconnects when a
+	// ping goes unanswered for this long, instead of waiting for ReadTimeout.
+	DeadConnectionTimeout time.Duration
+
+	// MaxRetries <= 0 retries forever.
 	MaxRetries    int
 	RetryInterval time.Duration
+
+	// StableConnectionThreshold is how long a connection must stay up before
+	// the reconnect backoff resets. Shorter-lived connections keep escalating
+	// the delay, but only failed dials count against MaxRetries. Zero resets
+	// the backoff on every successful connect.
+	StableConnectionThreshold time.Duration
+
+	CorrelationExtractor func(msg []byte) (id string, ok bool)
+	IDGenerator          func() string
+
+	HMACSecret []byte
+	HMACField  string
+	HMACHash   func() hash.Hash
+
+	SendBufferSize      int
+	IdempotencyKeyField string
+
+	// BufferHighWater and BufferLowWater are fractions of SendBufferSize at
+	// which OnBufferHighWater and OnBufferLowWater fire. They default to 0.8
+	// and half the high-water mark.
+	BufferHighWater float64
+	BufferLowWater  float64
+
+	DedupWindow time.Duration
+
+	// MessageBufferSize > 0 delivers inbound messages on Messages() instead
+	// of OnMessage. A full channel blocks the read loop, so a consumer that
+	// falls behind for longer than ReadTimeout will cause a disconnect.
+	MessageBufferSize  int
+	DropWhenBufferFull bool
+	DropRateThreshold  float64
+	DropRateWindow     time.Duration
+
+	SyncMarker  []byte
+	PanicPolicy PanicPolicy
+
+	// PreferText keeps sending text frames when the server's
+	// X-Frame-Capability handshake header also offers binary. By default the
+	// client switches to binary whenever the server supports it.
+	PreferText bool
+
+	PauseStopsReading bool
+
+	// MaxHeldMessages caps how many messages Pause holds in memory when
+	// PauseStopsReading is off. Messages beyond it are dropped and reported
+	// to OnError as ErrHeldMessagesFull. Zero holds up to 1024.
+	MaxHeldMessages int
+
+	Tracer       Tracer
+	TraceContext context.Context
+
+	// DisableAutoPong stops the client replying to server pings. Only an
+	// OnPing handler can then keep the connection alive, and servers that
+	// expect pongs may time the client out.
+	DisableAutoPong bool
+
+	// ProtocolVersion is checked against the server's X-Protocol-Version
+	// handshake header. A mismatch stops the client instead of retrying.
+	ProtocolVersion string
+
+	SendRateLimit float64
+	SendBurst     int
+	RateLimitMode RateLimitMode
 }
 
 func NewClientConfig(scheme, host, port, path, clientId string, retryInterval, maxRetries int) *ClientConfig {
@@ -48,7 +156,94 @@ func NewClientConfig(scheme, host, port, path, clientId string, retryInterval, m
 
 		MaxRetries:    maxRetries,
 		RetryInterval: time.Duration(retryInterval) * time.Second,
+
+		StableConnectionThreshold: 30 * time.Second,
+	}
+}
+
+func (cfg *ClientConfig) endpoints() []string {
+	if len(cfg.Endpoints) > 0 {
+		return cfg.Endpoints
+	}
+	return []string{fmt.Sprintf("%s://%s:%s%s", cfg.Scheme, cfg.Host, cfg.Port, cfg.Path)}
+}
+
+func (cfg *ClientConfig) dialURL(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return "", err
+	}
+
+	if len(cfg.Query) > 0 {
+		query := u.Query()
+		for key, values := range cfg.Query {
+			for _, value := range values {
+				query.Add(key, value)
+			}
+		}
+		u.RawQuery = query.Encode()
+	}
+	return u.String(), nil
+}
+
+func (cfg *ClientConfig) SetProxyURL(rawURL string) error {
+	proxyURL, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("invalid proxy url: %w", err)
+	}
+	cfg.Proxy = http.ProxyURL(proxyURL)
+	return nil
+}
+
+func (cfg *ClientConfig) dialHeaders() http.Header {
+	if cfg.HeadersFunc == nil {
+		return cfg.Headers
+	}
+
+	headers := cfg.Headers.Clone()
+	if headers == nil {
+		headers = http.Header{}
+	}
+	for key, values := range cfg.HeadersFunc() {
+		headers[key] = values
+	}
+	return headers
+}
+
+// RetrySchedule returns up to maxEntries delays the client waits between
+// consecutive failed dials, capped by MaxRetries, starting from a stable
+// state. After short-lived connections (see StableConnectionThreshold) the
+// real delays are longer; RetryScheduleAfterFlaps models that case.
+func (cfg *ClientConfig) RetrySchedule(maxEntries int) []time.Duration {
+	return cfg.RetryScheduleAfterFlaps(0, maxEntries)
+}
+
+// RetryScheduleAfterFlaps is RetrySchedule for a client whose last flaps
+// connections each dropped before StableConnectionThreshold. Every flap
+// shifts the whole schedule one step further along the backoff.
+func (cfg *ClientConfig) RetryScheduleAfterFlaps(flaps, maxEntries int) []time.Duration {
+	if cfg.StableConnectionThreshold <= 0 {
+		flaps = 0
+	}
+	flaps = max(flaps, 0)
+
+	n := maxEntries
+	if cfg.MaxRetries > 0 && cfg.MaxRetries-1 < n {
+		n = cfg.MaxRetries - 1
+	}
+	if n <= 0 {
+		return nil
+	}
+
+	schedule := make([]time.Duration, 0, n)
+	for attempt := 1; attempt <= n; attempt++ {
+		schedule = append(schedule, cfg.retryDelay(attempt+flaps))
 	}
+	return schedule
+}
+
+func (cfg *ClientConfig) retryDelay(attempt int) time.Duration {
+	return time.Duration(attempt) * cfg.RetryInterval
 }
 
 type ClientCallbacks struct {
@@ -58,13 +253,28 @@ type ClientCallbacks struct {
 	OnDisconnect func(err error)
 	OnMessage    func(msg []byte)
 	OnError      func(err error)
+	OnClose      func(code int, text string)
+	OnPong       func(rtt time.Duration)
+	OnPing       func(appData string)
+
+	OnHighDropRate func(rate float64)
+
+	OnBufferHighWater func(depth int, capacity int)
+	OnBufferLowWater  func(depth int, capacity int)
+
+	OnNotification func(method string, params json.RawMessage)
+
+	// OnMessageBuffered replaces OnMessage and Messages() with a pooled read
+	// path. msg is only valid until the callback returns; copy it to keep it.
+	OnMessageBuffered func(msg []byte)
 }
 
 type Client struct {
 	config    *ClientConfig
 	callbacks *ClientCallbacks
 
-	conn      *websocket.Conn
+	conn      wsConn
+	dial      func(ctx context.Context, url string, header http.Header) (wsConn, *http.Response, error)
 	mu        sync.RWMutex
 	writeMu   sync.Mutex
 	startOnce sync.Once
@@ -73,27 +283,83 @@ type Client struct {
 
 	ctx    context.Context
 	cancel context.CancelFunc
-	logger *log.Logger
+	logger Logger
 
 	retryCount int
+	flapCount  int
+	dialed     bool
+
+	reconnectMu  sync.Mutex
+	reconnectOff atomic.Bool
+	reconnectOn  chan struct{}
+
+	reconnects reconnectTracker
+	latency    atomic.Int64
+	resyncing  atomic.Bool
+	frameType  atomic.Int32
+	stopping   atomic.Bool
+	lastMsgAt  atomic.Int64
+	pingSentAt atomic.Int64
+
+	disconnectReason atomic.Int32
+
+	endpointIndex  int
+	activeEndpoint string
+	connected      chan struct{}
+
+	pendingMu sync.Mutex
+	pending   map[string]chan []byte
+
+	outbox     [][]byte
+	buffered   uint64
+	flushed    uint64
+	flushedSig chan struct{}
+	bufferHigh bool
+	messages   chan []byte
+	drops      dropTracker
+	dedup      dedupCache
+
+	captureMu sync.Mutex
+	capture   io.Writer
+
+	pauseMu   sync.Mutex
+	deliverMu sync.Mutex
+	paused    bool
+	resume    chan struct{}
+	held      [][]byte
+
+	sendLimiter sendLimiter
+
+	asyncOnce  sync.Once
+	asyncMu    sync.Mutex
+	asyncQueue chan asyncSend
 }
 
-func NewClient(config *ClientConfig, callback *ClientCallbacks, logger *log.Logger) *Client {
+func NewClient(config *ClientConfig, callback *ClientCallbacks, logger Logger) *Client {
 	if callback == nil {
 		callback = &ClientCallbacks{}
 	}
 	if logger == nil {
-		logger = log.New(os.Stdout, "[ws-client] ", log.LstdFlags|log.Llongfile)
+		logger = NewStdLogger(log.New(os.Stdout, "[ws-client] ", log.LstdFlags|log.Llongfile))
 	}
 	ctx, cancel := context.WithCancel(context.Background())
 
-	return &Client{
+	var messages chan []byte
+	if config.MessageBufferSize > 0 {
+		messages = make(chan []byte, config.MessageBufferSize)
+	}
+
+	c := &Client{
 		config:    config,
 		callbacks: callback,
 		ctx:       ctx,
 		cancel:    cancel,
 		logger:    logger,
+		pending:   make(map[string]chan []byte),
+		messages:  messages,
 	}
+	c.dial = c.dialWebsocket
+	return c
 }
 
 func (c *Client) OnStarted(handler func()) {
@@ -120,6 +386,53 @@ func (c *Client) OnError(handler func(err error)) {
 	c.callbacks.OnError = handler
 }
 
+func (c *Client) OnClose(handler func(code int, text string)) {
+	c.callbacks.OnClose = handler
+}
+
+func (c *Client) OnPong(handler func(rtt time.Duration)) {
+	c.callbacks.OnPong = handler
+}
+
+func (c *Client) OnPing(handler func(appData string)) {
+	c.callbacks.OnPing = handler
+}
+
+func (c *Client) Latency() time.Duration {
+	return time.Duration(c.latency.Load())
+}
+
+func (c *Client) OnMessageBuffered(handler func(msg []byte)) {
+	c.callbacks.OnMessageBuffered = handler
+}
+
+func (c *Client) OnHighDropRate(handler func(rate float64)) {
+	c.callbacks.OnHighDropRate = handler
+}
+
+func (c *Client) OnBufferHighWater(handler func(depth int, capacity int)) {
+	c.callbacks.OnBufferHighWater = handler
+}
+
+func (c *Client) OnBufferLowWater(handler func(depth int, capacity int)) {
+	c.callbacks.OnBufferLowWater = handler
+}
+
+func (c *Client) OnNotification(handler func(method string, params json.RawMessage)) {
+	c.callbacks.OnNotification = handler
+}
+
+func (c *Client) LastMessageAt() time.Time {
+	if at := c.lastMsgAt.Load(); at != 0 {
+		return time.Unix(0, at)
+	}
+	return time.Time{}
+}
+
+func (c *Client) Messages() <-chan []byte {
+	return c.messages
+}
+
 func (c *Client) Start() {
 	c.startOnce.Do(func() {
 		c.wg.Add(1)
@@ -130,33 +443,82 @@ func (c *Client) Start() {
 	})
 }
 
+// StartContext starts the client and stops it, as Stop would, once ctx is
+// cancelled.
+func (c *Client) StartContext(ctx context.Context) {
+	stop := context.AfterFunc(ctx, c.Stop)
+	context.AfterFunc(c.ctx, func() { stop() })
+	c.Start()
+}
+
 func (c *Client) Stop() {
+	c.stop(websocket.CloseNormalClosure, "shutting down normally")
+}
+
+func (c *Client) stop(code int, reason string) {
 	c.stopOnce.Do(func() {
 		c.cancel()
-		c.closeConn()
+		c.closeConnWithCode(code, reason)
 		c.wg.Wait()
+		if c.messages != nil {
+			// Resume can still be flushing held messages from the caller's
+			// goroutine; it checks ctx under deliverMu before each send.
+			c.deliverMu.Lock()
+			close(c.messages)
+			c.deliverMu.Unlock()
+		}
 		if c.callbacks.Stopped != nil {
 			c.callbacks.Stopped()
 		}
 	})
 }
 
+// Send writes msg, or buffers it while disconnected when SendBufferSize > 0.
+// Messages reach the wire in the order their Send calls succeeded, including
+// those flushed after a reconnect. A Send that returns an error leaves a gap
+// in that sequence; it never causes later messages to overtake earlier ones.
 func (c *Client) Send(msg interface{}) error {
-	conn := c.getConn()
-	if conn == nil {
-		return errors.New("websocket client: not connected")
-	}
+	return c.SendContext(context.Background(), msg)
+}
 
-	c.writeMu.Lock()
-	defer c.writeMu.Unlock()
+// SendContext is Send, but a wait for a SendRateLimit token also ends when
+// ctx is done.
+func (c *Client) SendContext(ctx context.Context, msg interface{}) error {
+	_, err := c.send(ctx, msg)
+	return err
+}
 
-	conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
-	if err := conn.WriteJSON(msg); err != nil {
-		return err
+// send is SendContext that also returns the outbox ticket when msg was
+// buffered rather than written; see waitFlushed.
+func (c *Client) send(ctx context.Context, msg interface{}) (uint64, error) {
+	defer c.startSpan("websocket.send")()
+
+	if c.config.HMACSecret != nil {
+		signed, err := c.signMessage(msg)
+		if err != nil {
+			return 0, err
+		}
+		msg = signed
 	}
 
-	conn.SetWriteDeadline(time.Time{})
-	return nil
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrEncode, err)
+	}
+	duplicate, forget := c.suppressDuplicate(data)
+	if duplicate {
+		return 0, ErrDuplicateSuppressed
+	}
+	if err := c.waitSendToken(ctx); err != nil {
+		forget()
+		return 0, err
+	}
+	ticket, err := c.writeOrBuffer(data)
+	if err != nil {
+		forget()
+		return 0, err
+	}
+	return ticket, nil
 }
 
 func (c *Client) run() {
@@ -165,9 +527,21 @@ func (c *Client) run() {
 		case <-c.ctx.Done():
 			return
 		default:
-			err := c.subscribe()
+			if c.dialed && !c.awaitReconnect() {
+				return
+			}
+
+			var backoff time.Duration
+			err := c.connect()
+			if errors.Is(err, ErrProtocolMismatch) {
+				c.logger.Errorf("Stopping client: %v", err)
+				if c.callbacks.OnError != nil {
+					c.callbacks.OnError(err)
+				}
+				return
+			}
 			if err != nil {
-				c.logger.Printf("Connection failed (attempt %d/%d): %v", c.retryCount+1, c.config.MaxRetries, err)
+				c.logger.Warnf("Connection failed (attempt %d/%d): %v", c.retryCount+1, c.config.MaxRetries, err)
 
 				if c.callbacks.OnError != nil {
 					c.callbacks.OnError(err)
@@ -175,16 +549,16 @@ func (c *Client) run() {
 
 				c.retryCount++
 
-				if c.retryCount >= c.config.MaxRetries {
-					c.logger.Printf("Max retries (%d) exceeded. Stopping client.", c.config.MaxRetries)
+				if c.config.MaxRetries > 0 && c.retryCount >= c.config.MaxRetries {
+					c.logger.Errorf("Max retries (%d) exceeded. Stopping client.", c.config.MaxRetries)
 					if c.callbacks.OnError != nil {
 						c.callbacks.OnError(fmt.Errorf("max retries exceeded: %d", c.config.MaxRetries))
 					}
 					return
 				}
 
-				waitTime := time.Duration(c.retryCount) * c.config.RetryInterval
-				c.logger.Printf("Retrying in %v... (attempt %d)", waitTime, c.retryCount)
+				waitTime := c.config.retryDelay(c.retryCount + c.flapCount)
+				c.logger.Infof("Retrying in %v... (attempt %d)", waitTime, c.retryCount)
 
 				select {
 				case <-c.ctx.Done():
@@ -193,7 +567,13 @@ func (c *Client) run() {
 					continue
 				}
 			} else {
+				connectedAt := time.Now()
 				c.retryCount = 0
+				c.reconnects.connected(connectedAt)
+
+				if err := c.flushOutbox(); err != nil {
+					c.logger.Errorf("Flushing buffered messages failed: %v", err)
+				}
 
 				pingCtx, pingCancel := context.WithCancel(c.ctx)
 				go c.ping(pingCtx)
@@ -201,22 +581,77 @@ func (c *Client) run() {
 				c.read()
 
 				pingCancel()
+				c.reconnects.disconnected(time.Now())
+
+				if threshold := c.config.StableConnectionThreshold; threshold > 0 {
+					if uptime := time.Since(connectedAt); uptime >= threshold {
+						c.flapCount = 0
+					} else {
+						c.flapCount++
+						backoff = c.config.retryDelay(c.flapCount)
+						c.logger.Warnf("Connection dropped after %v, reconnecting in %v", uptime.Round(time.Millisecond), backoff)
+					}
+				}
 			}
 
 			c.closeConn()
+
+			if backoff > 0 && !c.reconnectOff.Load() {
+				select {
+				case <-c.ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+			}
+		}
+	}
+}
+
+func (c *Client) connect() error {
+	if c.dialed && c.config.BeforeReconnect != nil {
+		if err := c.config.BeforeReconnect(c.retryCount + 1); err != nil {
+			return fmt.Errorf("before reconnect: %w", err)
 		}
 	}
+	c.dialed = true
+	return c.subscribe()
 }
 
 func (c *Client) subscribe() error {
-	url := fmt.Sprintf("%s://%s:%s%s", c.config.Scheme, c.config.Host, c.config.Port, c.config.Path)
-	dialer := websocket.DefaultDialer
-	dialer.HandshakeTimeout = c.config.HandshakeTimeout
-	conn, _, err := dialer.Dial(url, c.config.Headers)
+	defer c.startSpan("websocket.connect")()
+
+	endpoints := c.config.endpoints()
+	endpoint := endpoints[c.endpointIndex%len(endpoints)]
+	c.endpointIndex++
+
+	dialURL, err := c.config.dialURL(endpoint)
 	if err != nil {
 		return err
 	}
 
+	dialCtx := c.ctx
+	if c.config.DialTimeout > 0 {
+		var cancel context.CancelFunc
+		dialCtx, cancel = context.WithTimeout(c.ctx, c.config.DialTimeout)
+		defer cancel()
+	}
+	conn, resp, err := c.dial(dialCtx, dialURL, c.config.dialHeaders())
+	if err != nil {
+		if errors.Is(dialCtx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w after %v: %v", ErrDialTimeout, c.config.DialTimeout, err)
+		}
+		return err
+	}
+	if err := c.checkProtocolVersion(resp); err != nil {
+		conn.Close()
+		return err
+	}
+	c.negotiateFrameType(resp)
+
+	c.mu.Lock()
+	c.activeEndpoint = endpoint
+	c.mu.Unlock()
+
 	if c.callbacks.Started != nil {
 		c.callbacks.Started()
 	}
@@ -226,8 +661,42 @@ func (c *Client) subscribe() error {
 	conn.SetReadLimit(int64(c.config.MaxReadMessageSize))
 	conn.SetReadDeadline(time.Now().Add(c.config.ReadTimeout))
 
-	conn.SetPongHandler(func(string) error {
+	conn.SetPongHandler(func(appData string) error {
 		conn.SetReadDeadline(time.Now().Add(c.config.ReadTimeout))
+		c.pingSentAt.Store(0)
+		if sentAt, err := strconv.ParseInt(appData, 10, 64); err == nil {
+			rtt := time.Since(time.Unix(0, sentAt))
+			c.latency.Store(int64(rtt))
+			if c.callbacks.OnPong != nil {
+				c.callbacks.OnPong(rtt)
+			}
+		}
+		return nil
+	})
+
+	conn.SetPingHandler(func(appData string) error {
+		if c.callbacks.OnPing != nil {
+			c.callbacks.OnPing(appData)
+		}
+		if c.config.DisableAutoPong {
+			return nil
+		}
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+		err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(c.config.WriteTimeout))
+		if errors.Is(err, websocket.ErrCloseSent) {
+			return nil
+		}
+		return err
+	})
+
+	conn.SetCloseHandler(func(code int, text string) error {
+		if c.callbacks.OnClose != nil {
+			c.callbacks.OnClose(code, text)
+		}
+		c.writeMu.Lock()
+		defer c.writeMu.Unlock()
+		_ = conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(c.config.WriteTimeout))
 		return nil
 	})
 
@@ -238,27 +707,71 @@ func (c *Client) subscribe() error {
 	return nil
 }
 
+// dialWebsocket is the default Client.dial, opening a real connection with
+// the handshake, buffer, proxy and NetDial settings from the config.
+func (c *Client) dialWebsocket(ctx context.Context, url string, header http.Header) (wsConn, *http.Response, error) {
+	dialer := *websocket.DefaultDialer
+	dialer.HandshakeTimeout = c.config.HandshakeTimeout
+	dialer.ReadBufferSize = c.config.ReadBufferSize
+	if c.config.Proxy != nil {
+		dialer.Proxy = c.config.Proxy
+	}
+	if c.config.NetDial != nil {
+		dialer.NetDial = c.config.NetDial
+	}
+	conn, resp, err := dialer.DialContext(ctx, url, header)
+	if err != nil {
+		return nil, resp, err
+	}
+	return conn, resp, nil
+}
+
 func (c *Client) ping(ctx context.Context) {
 	ticker := time.NewTicker(c.config.ReadTimeout / 2)
 	defer ticker.Stop()
 
+	c.pingSentAt.Store(0)
+	var pongDeadline <-chan time.Time
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-pongDeadline:
+			pongDeadline = nil
+			sentAt := c.pingSentAt.Load()
+			if sentAt == 0 || c.config.PauseStopsReading && c.IsPaused() {
+				continue
+			}
+			err := fmt.Errorf("%w: no pong for %v", ErrDeadConnection, time.Since(time.Unix(0, sentAt)).Round(time.Millisecond))
+			c.logger.Warnf("%v", err)
+			if c.callbacks.OnError != nil {
+				c.callbacks.OnError(err)
+			}
+			c.markDisconnect(DisconnectPingTimeout)
+			if conn := c.getConn(); conn != nil {
+				_ = conn.Close()
+			}
+			return
 		case <-ticker.C:
 			conn := c.getConn()
 			if conn != nil {
 				c.writeMu.Lock()
-				err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(c.config.WriteTimeout))
+				now := time.Now()
+				payload := []byte(strconv.FormatInt(now.UnixNano(), 10))
+				err := conn.WriteControl(websocket.PingMessage, payload, now.Add(c.config.WriteTimeout))
 				c.writeMu.Unlock()
 				if err != nil {
-					c.logger.Printf("Ping error: %v", err)
+					c.markDisconnect(DisconnectWriteError)
+					c.logger.Errorf("Ping error: %v", err)
 					if c.callbacks.OnError != nil {
 						c.callbacks.OnError(err)
 					}
 					return
 				}
+				if c.config.DeadConnectionTimeout > 0 && c.pingSentAt.CompareAndSwap(0, now.UnixNano()) {
+					pongDeadline = time.After(c.config.DeadConnectionTimeout)
+				}
 			}
 		}
 	}
@@ -275,38 +788,131 @@ func (c *Client) read() {
 		case <-c.ctx.Done():
 			return
 		default:
-			_, msg, err := conn.ReadMessage()
+			if !c.waitIfPaused(conn) {
+				return
+			}
+			messageType, msg, release, err := c.readMessage(conn)
 			if err != nil {
-				if c.ctx.Err() == nil && c.callbacks.OnDisconnect != nil {
-					c.callbacks.OnDisconnect(err)
+				if c.callbacks.OnDisconnect != nil {
+					c.callbacks.OnDisconnect(c.disconnectError(err))
 				}
 				return
 			}
-			if c.callbacks.OnMessage != nil {
-				c.callbacks.OnMessage(msg)
+			c.lastMsgAt.Store(time.Now().UnixNano())
+			c.captureFrame(captureInbound, messageType, msg)
+			keep := c.deliver(msg)
+			release()
+			if !keep {
+				return
 			}
 		}
 	}
 }
 
-func (c *Client) setConn(conn *websocket.Conn) {
+func (c *Client) handleMessage(msg []byte) bool {
+	defer c.startSpan("websocket.receive")()
+
+	if c.skipUntilSync(msg) {
+		c.recordDelivery(true)
+		return true
+	}
+
+	if c.config.HMACSecret != nil {
+		payload, err := c.verifyMessage(msg)
+		if err != nil {
+			c.logger.Warnf("Rejected inbound message: %v", err)
+			if c.callbacks.OnError != nil {
+				c.callbacks.OnError(err)
+			}
+			c.recordDelivery(true)
+			return true
+		}
+		msg = payload
+	}
+
+	if c.config.ReconnectOnMessage != nil && c.config.ReconnectOnMessage(msg) {
+		c.logger.Infof("Reconnect requested by server message")
+		return false
+	}
+
+	if c.resolvePending(msg) {
+		return true
+	}
+
+	if c.dispatchNotification(msg) {
+		return true
+	}
+
+	if c.callbacks.OnMessageBuffered != nil {
+		c.recordDelivery(false)
+		c.callbacks.OnMessageBuffered(msg)
+		return true
+	}
+
+	if c.messages != nil {
+		if c.config.DropWhenBufferFull {
+			select {
+			case c.messages <- msg:
+				c.recordDelivery(false)
+			default:
+				c.recordDelivery(true)
+			}
+			return true
+		}
+		select {
+		case c.messages <- msg:
+		case <-c.ctx.Done():
+			return false
+		}
+		c.recordDelivery(false)
+		return true
+	}
+
+	c.recordDelivery(false)
+	if c.callbacks.OnMessage != nil {
+		c.callbacks.OnMessage(msg)
+	}
+	return true
+}
+
+func (c *Client) setConn(conn wsConn) {
 	c.mu.Lock()
 	c.conn = conn
+	c.disconnectReason.Store(0)
+	if connected := c.connectedSignalLocked(); conn != nil {
+		select {
+		case <-connected:
+		default:
+			close(connected)
+		}
+	}
 	c.mu.Unlock()
 }
 
-func (c *Client) getConn() *websocket.Conn {
+func (c *Client) ActiveEndpoint() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.activeEndpoint
+}
+
+func (c *Client) getConn() wsConn {
 	c.mu.RLock()
 	defer c.mu.RUnlock()
 	return c.conn
 }
 
 func (c *Client) closeConn() {
+	c.closeConnWithCode(websocket.CloseNormalClosure, "shutting down normally")
+}
+
+func (c *Client) closeConnWithCode(code int, reason string) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	if c.conn != nil {
-		_ = c.conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, "shutting down normally"))
+		c.markDisconnect(DisconnectLocalStop)
+		_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(c.config.WriteTimeout))
 		_ = c.conn.Close()
 		c.conn = nil
+		c.connected = nil
 	}
 }
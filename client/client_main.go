@@ -36,12 +36,15 @@ func main() {
 		},
 	}
 
-	client := NewClient(config, callbacks, logger)
+	client := NewClient(config, callbacks, NewStdLogger(logger))
 
 	client.Start()
 
 	go func() {
-		time.Sleep(5 * time.Second)
+		if err := client.WaitForConnection(5 * time.Second); err != nil {
+			logger.Println("Not connected:", err)
+			return
+		}
 		err := client.Send("Hello from Client " + clientId)
 		if err != nil {
 			logger.Println("Send failed:", err)
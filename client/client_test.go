@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func discardLogger() Logger {
+	return NewStdLogger(log.New(io.Discard, "", 0))
+}
+
+// newTestServer starts a loopback WebSocket server that runs handle for
+// every upgraded connection and returns its host:port.
+func newTestServer(t testing.TB, header http.Header, handle func(conn *websocket.Conn)) string {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{CheckOrigin: func(r *http.Request) bool { return true }}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, header)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}))
+	t.Cleanup(ts.Close)
+	return ts.Listener.Addr().String()
+}
+
+// newTestClient builds a client for addr that retries quickly and forever.
+// configure may adjust the config; the client is stopped on cleanup but not
+// started.
+func newTestClient(t *testing.T, addr string, configure func(cfg *ClientConfig), callbacks *ClientCallbacks) *Client {
+	t.Helper()
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		t.Fatalf("split %q: %v", addr, err)
+	}
+	cfg := NewClientConfig("ws", host, port, "/", "test", 0, 0)
+	cfg.RetryInterval = 10 * time.Millisecond
+	if configure != nil {
+		configure(cfg)
+	}
+	c := NewClient(cfg, callbacks, discardLogger())
+	t.Cleanup(c.Stop)
+	return c
+}
+
+func startConnected(t *testing.T, c *Client) {
+	t.Helper()
+
+	c.Start()
+	if err := c.WaitForConnection(2 * time.Second); err != nil {
+		t.Fatalf("WaitForConnection: %v", err)
+	}
+}
+
+// waitFor polls cond until it holds or the timeout passes.
+func waitFor(t *testing.T, timeout time.Duration, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestPeerCloseFiresOnCloseAndOnDisconnect(t *testing.T) {
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(4001, "bye"))
+		conn.ReadMessage()
+	})
+
+	type closeEvent struct {
+		code int
+		text string
+	}
+	closes := make(chan closeEvent, 16)
+	disconnects := make(chan error, 16)
+	c := newTestClient(t, addr, nil, &ClientCallbacks{
+		OnClose: func(code int, text string) {
+			select {
+			case closes <- closeEvent{code, text}:
+			default:
+			}
+		},
+		OnDisconnect: func(err error) {
+			select {
+			case disconnects <- err:
+			default:
+			}
+		},
+	})
+	c.Start()
+
+	select {
+	case ev := <-closes:
+		if ev.code != 4001 || ev.text != "bye" {
+			t.Fatalf("OnClose(%d, %q), want (4001, \"bye\")", ev.code, ev.text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnClose not called")
+	}
+
+	select {
+	case err := <-disconnects:
+		var de *DisconnectError
+		if !errors.As(err, &de) || de.Reason != DisconnectPeerClosed {
+			t.Fatalf("OnDisconnect(%v), want DisconnectPeerClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called when OnClose is set")
+	}
+}
+
+func TestDroppedConnectionIsReadError(t *testing.T) {
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		// Drop the TCP connection without a close frame.
+		conn.UnderlyingConn().Close()
+	})
+
+	disconnects := make(chan error, 1)
+	c := newTestClient(t, addr, nil, &ClientCallbacks{
+		OnDisconnect: func(err error) {
+			select {
+			case disconnects <- err:
+			default:
+			}
+		},
+	})
+	c.Start()
+
+	select {
+	case err := <-disconnects:
+		var de *DisconnectError
+		if !errors.As(err, &de) || de.Reason != DisconnectReadError {
+			t.Fatalf("OnDisconnect(%v), want DisconnectReadError", err)
+		}
+		if !websocket.IsCloseError(de.Err, websocket.CloseAbnormalClosure) {
+			t.Fatalf("OnDisconnect(%v), want the underlying 1006 error", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+}
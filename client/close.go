@@ -0,0 +1,43 @@
+package main
+
+import (
+	"fmt"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const maxCloseReasonBytes = 123
+
+// CloseWith stops the client like Stop, but sends code and reason in the
+// close frame. The reason is truncated to fit a control frame.
+func (c *Client) CloseWith(code int, reason string) error {
+	if !validCloseCode(code) {
+		return fmt.Errorf("websocket client: invalid close code: %d", code)
+	}
+	c.stop(code, truncateReason(reason))
+	return nil
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code >= websocket.CloseNormalClosure && code <= websocket.CloseTLSHandshake:
+		return code != 1004 && code != websocket.CloseNoStatusReceived &&
+			code != websocket.CloseAbnormalClosure && code != websocket.CloseTLSHandshake
+	default:
+		return false
+	}
+}
+
+func truncateReason(reason string) string {
+	if len(reason) <= maxCloseReasonBytes {
+		return reason
+	}
+	reason = reason[:maxCloseReasonBytes]
+	for !utf8.ValidString(reason) {
+		reason = reason[:len(reason)-1]
+	}
+	return reason
+}
@@ -0,0 +1,23 @@
+package main
+
+import (
+	"io"
+	"time"
+)
+
+// wsConn is the subset of *websocket.Conn the client uses, so tests can
+// substitute wstest.FakeConn for a real socket.
+type wsConn interface {
+	ReadMessage() (messageType int, p []byte, err error)
+	NextReader() (messageType int, r io.Reader, err error)
+	WriteMessage(messageType int, data []byte) error
+	NextWriter(messageType int) (io.WriteCloser, error)
+	WriteControl(messageType int, data []byte, deadline time.Time) error
+	SetReadDeadline(t time.Time) error
+	SetWriteDeadline(t time.Time) error
+	SetReadLimit(limit int64)
+	SetPingHandler(h func(appData string) error)
+	SetPongHandler(h func(appData string) error)
+	SetCloseHandler(h func(code int, text string) error)
+	Close() error
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+// newFakeClient returns a started client whose every dial yields conn.
+// configure may adjust the config before the client is built.
+func newFakeClient(t *testing.T, conn *wstest.FakeConn, configure func(cfg *ClientConfig), callbacks *ClientCallbacks) *Client {
+	t.Helper()
+
+	cfg := NewClientConfig("ws", "fake", "0", "/", "test", 0, 0)
+	if configure != nil {
+		configure(cfg)
+	}
+	c := NewClient(cfg, callbacks, discardLogger())
+	c.dial = func(ctx context.Context, url string, header http.Header) (wsConn, *http.Response, error) {
+		return conn, nil, nil
+	}
+	t.Cleanup(c.Stop)
+	startConnected(t, c)
+	return c
+}
+
+func TestClientWithFakeConn(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	messages := make(chan string, 1)
+	closes := make(chan int, 1)
+	c := newFakeClient(t, conn, nil, &ClientCallbacks{
+		OnMessage: func(msg []byte) { messages <- string(msg) },
+		OnClose:   func(code int, text string) { closes <- code },
+	})
+
+	conn.QueueRead(websocket.TextMessage, []byte("hello"))
+	select {
+	case got := <-messages:
+		if got != "hello" {
+			t.Fatalf("OnMessage(%q)", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnMessage not called")
+	}
+
+	if err := c.Send(map[string]int{"n": 1}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	writes := conn.Writes()
+	if len(writes) != 1 || string(writes[0].Data) != `{"n":1}` {
+		t.Fatalf("writes = %+v, want one frame {\"n\":1}", writes)
+	}
+
+	conn.QueueClose(4000, "done")
+	select {
+	case code := <-closes:
+		if code != 4000 {
+			t.Fatalf("OnClose(%d), want 4000", code)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnClose not called")
+	}
+}
+
+func TestLastMessageAtAdvances(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	received := make(chan struct{}, 2)
+	c := newFakeClient(t, conn, nil, &ClientCallbacks{
+		OnMessage: func(msg []byte) { received <- struct{}{} },
+	})
+
+	if at := c.LastMessageAt(); !at.IsZero() {
+		t.Fatalf("LastMessageAt() = %v before any message, want zero", at)
+	}
+
+	var last time.Time
+	for i := 0; i < 2; i++ {
+		before := time.Now()
+		conn.QueueRead(websocket.TextMessage, []byte("tick"))
+		select {
+		case <-received:
+		case <-time.After(time.Second):
+			t.Fatal("message not delivered")
+		}
+		at := c.LastMessageAt()
+		if at.Before(before) || !at.After(last) {
+			t.Fatalf("message %d: LastMessageAt() = %v, want after %v and %v", i+1, at, before, last)
+		}
+		last = at
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestSendUnencodableKeepsConnection(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	var disconnects atomic.Int32
+	c := newFakeClient(t, conn, nil, &ClientCallbacks{
+		OnDisconnect: func(err error) { disconnects.Add(1) },
+	})
+
+	if err := c.Send(make(chan int)); !errors.Is(err, ErrEncode) {
+		t.Fatalf("Send(chan) = %v, want ErrEncode", err)
+	}
+	if n := len(conn.Writes()); n != 0 || conn.Closed() || !c.IsConnected() {
+		t.Fatalf("encode error touched the connection: %d writes, closed %v", n, conn.Closed())
+	}
+
+	if err := c.Send("still up"); err != nil {
+		t.Fatalf("Send after an encode error: %v", err)
+	}
+	if n := len(conn.Writes()); n != 1 {
+		t.Fatalf("wrote %d messages, want 1", n)
+	}
+	if n := disconnects.Load(); n != 0 {
+		t.Fatalf("OnDisconnect called %d times after an encode error", n)
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+func (c *Client) IsConnected() bool {
+	return c.getConn() != nil
+}
+
+// WaitForConnection blocks until the client is connected, returning
+// context.DeadlineExceeded if that takes longer than timeout.
+func (c *Client) WaitForConnection(timeout time.Duration) error {
+	c.mu.Lock()
+	connected := c.connectedSignalLocked()
+	c.mu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-connected:
+		return nil
+	case <-timer.C:
+		return context.DeadlineExceeded
+	case <-c.ctx.Done():
+		return ErrStopping
+	}
+}
+
+// connectedSignalLocked returns a channel that is closed while a connection
+// is up. closeConn swaps in a fresh channel for the next connect.
+func (c *Client) connectedSignalLocked() chan struct{} {
+	if c.connected == nil {
+		c.connected = make(chan struct{})
+	}
+	return c.connected
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrDuplicateSuppressed = errors.New("websocket client: duplicate message suppressed")
+
+type dedupCache struct {
+	mu        sync.Mutex
+	sent      map[[sha256.Size]byte]time.Time
+	lastSweep time.Time
+}
+
+// suppressDuplicate reports whether data was sent within DedupWindow and,
+// if not, remembers it. The returned func forgets it again for sends that
+// end up failing, so a retry is not suppressed.
+func (c *Client) suppressDuplicate(data []byte) (bool, func()) {
+	window := c.config.DedupWindow
+	if window <= 0 {
+		return false, func() {}
+	}
+
+	sum := sha256.Sum256(data)
+	cache := &c.dedup
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := time.Now()
+	if cache.sent == nil {
+		cache.sent = make(map[[sha256.Size]byte]time.Time)
+	}
+	if now.Sub(cache.lastSweep) > window {
+		for k, at := range cache.sent {
+			if now.Sub(at) > window {
+				delete(cache.sent, k)
+			}
+		}
+		cache.lastSweep = now
+	}
+
+	if at, ok := cache.sent[sum]; ok && now.Sub(at) <= window {
+		return true, func() {}
+	}
+	cache.sent[sum] = now
+	return false, func() {
+		cache.mu.Lock()
+		defer cache.mu.Unlock()
+		if cache.sent[sum] == now {
+			delete(cache.sent, sum)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/gorilla/websocket"
+)
+
+type DisconnectReason int
+
+const (
+	DisconnectReadError DisconnectReason = iota
+	DisconnectPeerClosed
+	DisconnectReadTimeout
+	DisconnectWriteError
+	DisconnectPingTimeout
+	DisconnectLocalStop
+)
+
+func (r DisconnectReason) String() string {
+	switch r {
+	case DisconnectPeerClosed:
+		return "peer closed"
+	case DisconnectReadTimeout:
+		return "read timeout"
+	case DisconnectWriteError:
+		return "write error"
+	case DisconnectPingTimeout:
+		return "ping timeout"
+	case DisconnectLocalStop:
+		return "local stop"
+	default:
+		return "read error"
+	}
+}
+
+// DisconnectError is passed to OnDisconnect so callers can branch on Reason
+// with errors.As instead of matching error strings.
+type DisconnectError struct {
+	Reason DisconnectReason
+	Err    error
+}
+
+func (e *DisconnectError) Error() string {
+	return fmt.Sprintf("websocket client: disconnected (%s): %v", e.Reason, e.Err)
+}
+
+func (e *DisconnectError) Unwrap() error {
+	return e.Err
+}
+
+// markDisconnect records why the client is about to close the current
+// connection itself, so the read error that follows is reported with that
+// reason. The first cause recorded for a connection wins.
+func (c *Client) markDisconnect(reason DisconnectReason) {
+	c.disconnectReason.CompareAndSwap(0, int32(reason)+1)
+}
+
+func (c *Client) disconnectError(err error) *DisconnectError {
+	if r := c.disconnectReason.Load(); r != 0 {
+		return &DisconnectError{Reason: DisconnectReason(r - 1), Err: err}
+	}
+	if c.ctx.Err() != nil {
+		return &DisconnectError{Reason: DisconnectLocalStop, Err: err}
+	}
+
+	// gorilla reports a connection lost without a close frame as a 1006
+	// CloseError, but the peer never closed it.
+	var closeErr *websocket.CloseError
+	if errors.As(err, &closeErr) && closeErr.Code != websocket.CloseAbnormalClosure {
+		return &DisconnectError{Reason: DisconnectPeerClosed, Err: err}
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return &DisconnectError{Reason: DisconnectReadTimeout, Err: err}
+	}
+	return &DisconnectError{Reason: DisconnectReadError, Err: err}
+}
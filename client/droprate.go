@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const dropRateBuckets = 10
+
+type dropBucket struct {
+	start   int64
+	total   int
+	dropped int
+}
+
+type dropTracker struct {
+	mu       sync.Mutex
+	buckets  [dropRateBuckets]dropBucket
+	alerting bool
+}
+
+func (t *dropTracker) record(window time.Duration, threshold float64, dropped bool, now time.Time) (float64, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	width := int64(window / dropRateBuckets)
+	if width <= 0 {
+		width = 1
+	}
+	slot := now.UnixNano() / width
+	b := &t.buckets[slot%dropRateBuckets]
+	if b.start != slot {
+		*b = dropBucket{start: slot}
+	}
+	b.total++
+	if dropped {
+		b.dropped++
+	}
+
+	var total, drops int
+	for _, bucket := range t.buckets {
+		if slot-bucket.start < dropRateBuckets {
+			total += bucket.total
+			drops += bucket.dropped
+		}
+	}
+	rate := float64(drops) / float64(total)
+	fire := rate > threshold && !t.alerting
+	t.alerting = rate > threshold
+	return rate, fire
+}
+
+func (c *Client) recordDelivery(dropped bool) {
+	if c.callbacks.OnHighDropRate == nil || c.config.DropRateThreshold <= 0 {
+		return
+	}
+
+	window := c.config.DropRateWindow
+	if window <= 0 {
+		window = 10 * time.Second
+	}
+
+	if rate, fire := c.drops.record(window, c.config.DropRateThreshold, dropped, time.Now()); fire {
+		c.callbacks.OnHighDropRate(rate)
+	}
+}
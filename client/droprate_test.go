@@ -0,0 +1,74 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+func TestDropTrackerFiresOncePerExcursion(t *testing.T) {
+	var tracker dropTracker
+	now := time.Unix(1000, 0)
+	record := func(dropped bool) bool {
+		_, fire := tracker.record(10*time.Second, 0.5, dropped, now)
+		return fire
+	}
+
+	for i := 0; i < 4; i++ {
+		if record(false) {
+			t.Fatal("fired with no drops")
+		}
+	}
+	for i, want := range []bool{false, false, false, false, true, false} {
+		if fire := record(true); fire != want {
+			t.Fatalf("drop %d: fire = %v, want %v", i+1, fire, want)
+		}
+	}
+
+	// Once the drops age out of the window the rate recovers and a new
+	// excursion fires again.
+	now = now.Add(time.Minute)
+	for i, dropped := range []bool{false, false, true, true} {
+		if record(dropped) {
+			t.Fatalf("record %d fired at or below the threshold", i+1)
+		}
+	}
+	if !record(true) {
+		t.Fatal("second excursion did not fire")
+	}
+}
+
+func TestOnHighDropRateWhenBufferFull(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	var rates atomic.Value
+	var fired atomic.Int32
+
+	newFakeClient(t, conn, func(cfg *ClientConfig) {
+		cfg.MessageBufferSize = 2
+		cfg.DropWhenBufferFull = true
+		cfg.DropRateThreshold = 0.5
+	}, &ClientCallbacks{
+		OnHighDropRate: func(rate float64) {
+			rates.Store(rate)
+			fired.Add(1)
+		},
+	})
+
+	// Nothing reads Messages(), so all but the first two are dropped.
+	for i := 0; i < 10; i++ {
+		conn.QueueRead(websocket.TextMessage, []byte(`"msg"`))
+	}
+	waitFor(t, time.Second, func() bool { return fired.Load() > 0 })
+
+	time.Sleep(20 * time.Millisecond)
+	if n := fired.Load(); n != 1 {
+		t.Fatalf("OnHighDropRate fired %d times, want once", n)
+	}
+	if rate := rates.Load().(float64); rate != 0.6 {
+		t.Fatalf("OnHighDropRate(%v), want 0.6 (3 of 5 dropped)", rate)
+	}
+}
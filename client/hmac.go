@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrHMACMismatch = errors.New("websocket client: message hmac mismatch")
+
+func (cfg *ClientConfig) hmacField() string {
+	if cfg.HMACField == "" {
+		return "hmac"
+	}
+	return cfg.HMACField
+}
+
+func (cfg *ClientConfig) computeHMAC(payload []byte) string {
+	newHash := cfg.HMACHash
+	if newHash == nil {
+		newHash = sha256.New
+	}
+	mac := hmac.New(newHash, cfg.HMACSecret)
+	mac.Write(payload)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (c *Client) signMessage(msg interface{}) (map[string]json.RawMessage, error) {
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrEncode, err)
+	}
+
+	sum, err := json.Marshal(c.config.computeHMAC(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]json.RawMessage{
+		"payload":            payload,
+		c.config.hmacField(): sum,
+	}, nil
+}
+
+func (c *Client) verifyMessage(msg []byte) ([]byte, error) {
+	var envelope map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &envelope); err != nil {
+		return nil, fmt.Errorf("websocket client: decode signed message: %w", err)
+	}
+
+	var sum string
+	if err := json.Unmarshal(envelope[c.config.hmacField()], &sum); err != nil {
+		return nil, ErrHMACMismatch
+	}
+
+	payload := envelope["payload"]
+	if !hmac.Equal([]byte(sum), []byte(c.config.computeHMAC(payload))) {
+		return nil, ErrHMACMismatch
+	}
+	return payload, nil
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"crypto/sha512"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// hmacEchoServer verifies each signed envelope it receives with signer and
+// writes it back after passing it through tamper.
+func hmacEchoServer(t *testing.T, signer *ClientConfig, tamper func(envelope map[string]json.RawMessage)) string {
+	t.Helper()
+
+	return newTestServer(t, nil, func(conn *websocket.Conn) {
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			var envelope map[string]json.RawMessage
+			if err := json.Unmarshal(data, &envelope); err != nil {
+				t.Errorf("server got unsigned message %q", data)
+				return
+			}
+			var sum string
+			json.Unmarshal(envelope[signer.hmacField()], &sum)
+			if sum != signer.computeHMAC(envelope["payload"]) {
+				t.Errorf("server could not verify %q", data)
+			}
+			tamper(envelope)
+			reply, _ := json.Marshal(envelope)
+			conn.WriteMessage(websocket.TextMessage, reply)
+		}
+	})
+}
+
+func TestHMACRoundTrip(t *testing.T) {
+	signer := &ClientConfig{
+		HMACSecret: []byte("shared secret"),
+		HMACField:  "sig",
+		HMACHash:   sha512.New,
+	}
+	addr := hmacEchoServer(t, signer, func(map[string]json.RawMessage) {})
+
+	messages := make(chan []byte, 1)
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.HMACSecret = signer.HMACSecret
+		cfg.HMACField = signer.HMACField
+		cfg.HMACHash = signer.HMACHash
+	}, &ClientCallbacks{
+		OnMessage: func(msg []byte) { messages <- msg },
+		OnError:   func(err error) { t.Errorf("OnError(%v)", err) },
+	})
+	startConnected(t, c)
+
+	if err := c.Send(map[string]string{"hello": "world"}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case msg := <-messages:
+		if string(msg) != `{"hello":"world"}` {
+			t.Fatalf("OnMessage(%q), want the verified payload", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("signed echo not delivered")
+	}
+}
+
+func TestHMACRejectsTamperedMessage(t *testing.T) {
+	signer := &ClientConfig{HMACSecret: []byte("shared secret")}
+	addr := hmacEchoServer(t, signer, func(envelope map[string]json.RawMessage) {
+		envelope["payload"] = json.RawMessage(`"tampered"`)
+	})
+
+	errs := make(chan error, 1)
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.HMACSecret = signer.HMACSecret
+	}, &ClientCallbacks{
+		OnMessage: func(msg []byte) { t.Errorf("tampered message delivered: %q", msg) },
+		OnError:   func(err error) { errs <- err },
+	})
+	startConnected(t, c)
+
+	if err := c.Send("hello"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrHMACMismatch) {
+			t.Fatalf("OnError(%v), want ErrHMACMismatch", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("tampered message not rejected")
+	}
+	if !c.IsConnected() {
+		t.Fatal("rejecting a tampered message dropped the connection")
+	}
+}
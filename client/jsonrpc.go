@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+const jsonRPCVersion = "2.0"
+
+// RPCError is a JSON-RPC 2.0 error object returned by Call.
+type RPCError struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data,omitempty"`
+}
+
+func (e *RPCError) Error() string {
+	return fmt.Sprintf("jsonrpc error %d: %s", e.Code, e.Message)
+}
+
+type rpcRequest struct {
+	JSONRPC string `json:"jsonrpc"`
+	ID      string `json:"id,omitempty"`
+	Method  string `json:"method"`
+	Params  any    `json:"params,omitempty"`
+}
+
+type rpcResponse struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params"`
+	Result  json.RawMessage `json:"result"`
+	Error   *RPCError       `json:"error"`
+}
+
+// Call sends a JSON-RPC 2.0 request and waits for the matching response.
+// Request IDs come from IDGenerator, like Request's, so the two never
+// collide in the pending table. They are sent as strings so replies are
+// matched by the default correlation extractor; a custom
+// CorrelationExtractor must still recognise them.
+func (c *Client) Call(ctx context.Context, method string, params any) (json.RawMessage, error) {
+	id := c.nextID()
+	reply, err := c.roundTrip(ctx, id, rpcRequest{
+		JSONRPC: jsonRPCVersion,
+		ID:      id,
+		Method:  method,
+		Params:  params,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var resp rpcResponse
+	if err := json.Unmarshal(reply, &resp); err != nil {
+		return nil, fmt.Errorf("websocket client: decode jsonrpc response: %w", err)
+	}
+	if resp.Error != nil {
+		return nil, resp.Error
+	}
+	return resp.Result, nil
+}
+
+func (c *Client) Notify(method string, params any) error {
+	return c.Send(rpcRequest{
+		JSONRPC: jsonRPCVersion,
+		Method:  method,
+		Params:  params,
+	})
+}
+
+// dispatchNotification routes server-initiated JSON-RPC notifications to
+// OnNotification. Anything else falls through to normal delivery.
+func (c *Client) dispatchNotification(msg []byte) bool {
+	if c.callbacks.OnNotification == nil {
+		return false
+	}
+
+	var note rpcResponse
+	if err := json.Unmarshal(msg, &note); err != nil {
+		return false
+	}
+	if note.JSONRPC != jsonRPCVersion || note.Method == "" || len(note.ID) > 0 {
+		return false
+	}
+
+	c.recordDelivery(false)
+	c.callbacks.OnNotification(note.Method, note.Params)
+	return true
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestSendOrderAcrossReconnect(t *testing.T) {
+	const total = 200
+
+	var (
+		mu          sync.Mutex
+		seen        []int
+		connections atomic.Int32
+	)
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		first := connections.Add(1) == 1
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			seq, err := strconv.Atoi(string(msg))
+			if err != nil {
+				t.Errorf("server got %q", msg)
+				return
+			}
+			mu.Lock()
+			seen = append(seen, seq)
+			mu.Unlock()
+
+			// Drop the first connection mid-stream.
+			if first && seq == total/4 {
+				return
+			}
+			conn.WriteMessage(websocket.TextMessage, msg)
+		}
+	})
+
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.SendBufferSize = total
+	}, nil)
+	startConnected(t, c)
+
+	var sent []int
+	for seq := 0; seq < total; seq++ {
+		if err := c.Send(seq); err == nil {
+			sent = append(sent, seq)
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	waitFor(t, 5*time.Second, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(seen) > 0 && seen[len(seen)-1] == sent[len(sent)-1]
+	})
+	if n := connections.Load(); n < 2 {
+		t.Fatalf("server saw %d connections, want a reconnect mid-stream", n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i := 1; i < len(seen); i++ {
+		if seen[i] <= seen[i-1] {
+			t.Fatalf("server saw %d after %d: messages were reordered or duplicated", seen[i], seen[i-1])
+		}
+	}
+	if gaps := total - len(seen); gaps > 0 {
+		t.Logf("%d messages lost around the disconnect", gaps)
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrNotConnected = errors.New("websocket client: not connected")
+	ErrBufferFull   = errors.New("websocket client: send buffer full")
+	ErrStopping     = errors.New("websocket client: stopping")
+	ErrEncode       = errors.New("websocket client: encode message")
+)
+
+// writeOrBuffer writes data on the live connection, or appends it to the
+// outbox when disconnected and SendBufferSize allows it. Anything already
+// buffered is written first so wire order always matches Send order. A
+// buffered message gets a non-zero ticket that waitFlushed can wait on.
+func (c *Client) writeOrBuffer(data []byte) (uint64, error) {
+	c.writeMu.Lock()
+	ticket, err := c.writeOrBufferLocked(data)
+	notify := c.checkWatermark()
+	c.writeMu.Unlock()
+
+	notify()
+	return ticket, err
+}
+
+func (c *Client) writeOrBufferLocked(data []byte) (uint64, error) {
+	if c.stopping.Load() {
+		return 0, ErrStopping
+	}
+
+	conn := c.getConn()
+	if conn != nil && len(c.outbox) == 0 {
+		err := c.writeFrame(conn, data)
+		if err == nil || c.config.SendBufferSize <= 0 {
+			return 0, err
+		}
+		c.logger.Warnf("Write failed, buffering message: %v", err)
+	}
+
+	if c.config.SendBufferSize <= 0 {
+		return 0, ErrNotConnected
+	}
+	if len(c.outbox) >= c.config.SendBufferSize {
+		return 0, ErrBufferFull
+	}
+	c.outbox = append(c.outbox, data)
+	c.buffered++
+	return c.buffered, nil
+}
+
+// waitFlushed blocks until the buffered message holding ticket has been
+// written, or the client stops.
+func (c *Client) waitFlushed(ticket uint64) error {
+	for {
+		c.writeMu.Lock()
+		if c.flushed >= ticket {
+			c.writeMu.Unlock()
+			return nil
+		}
+		if c.flushedSig == nil {
+			c.flushedSig = make(chan struct{})
+		}
+		flushed := c.flushedSig
+		c.writeMu.Unlock()
+
+		select {
+		case <-flushed:
+		case <-c.ctx.Done():
+			return ErrStopping
+		}
+	}
+}
+
+func (c *Client) flushOutbox() error {
+	c.writeMu.Lock()
+	err := ErrNotConnected
+	if conn := c.getConn(); conn != nil {
+		err = c.flushOutboxLocked(conn)
+	}
+	notify := c.checkWatermark()
+	c.writeMu.Unlock()
+
+	notify()
+	return err
+}
+
+func (c *Client) flushOutboxLocked(conn wsConn) error {
+	defer func() {
+		if c.flushedSig != nil {
+			close(c.flushedSig)
+			c.flushedSig = nil
+		}
+	}()
+
+	for len(c.outbox) > 0 {
+		if err := c.writeFrame(conn, c.outbox[0]); err != nil {
+			return err
+		}
+		c.outbox[0] = nil
+		c.outbox = c.outbox[1:]
+		c.flushed++
+	}
+	c.outbox = nil
+	return nil
+}
+
+// StopGraceful rejects new sends, waits for buffered messages to be flushed
+// (which requires a live connection), then stops the client. If ctx expires
+// first the client is stopped anyway and the error reports what was lost.
+func (c *Client) StopGraceful(ctx context.Context) error {
+	c.stopping.Store(true)
+
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+
+	for {
+		c.writeMu.Lock()
+		remaining := len(c.outbox)
+		c.writeMu.Unlock()
+
+		if remaining == 0 {
+			c.Stop()
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			c.Stop()
+			return fmt.Errorf("websocket client: %d buffered messages not flushed: %w", remaining, ctx.Err())
+		case <-ticker.C:
+		}
+	}
+}
+
+func (c *Client) writeFrame(conn wsConn, data []byte) error {
+	messageType := c.FrameCapability()
+	conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+	if err := conn.WriteMessage(messageType, data); err != nil {
+		// Write errors are sticky, so nothing later could reach the wire on
+		// this connection. Close it so the read loop reconnects and the
+		// outbox is flushed, in order, on the next one.
+		c.markDisconnect(DisconnectWriteError)
+		conn.Close()
+		return err
+	}
+	conn.SetWriteDeadline(time.Time{})
+	c.captureFrame(captureOutbound, messageType, data)
+	return nil
+}
+
+func (c *Client) SendIdempotent(key string, msg interface{}) error {
+	field := c.config.IdempotencyKeyField
+	if field == "" {
+		field = "idempotency_key"
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrEncode, err)
+	}
+	encodedKey, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+
+	return c.Send(map[string]json.RawMessage{
+		field:     encodedKey,
+		"payload": payload,
+	})
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"websocket/wstest"
+)
+
+func TestSendIdempotentKeepsKeyAcrossReconnect(t *testing.T) {
+	first, second := wstest.NewFakeConn(), wstest.NewFakeConn()
+	redial := make(chan struct{})
+	var dials atomic.Int32
+
+	cfg := NewClientConfig("ws", "fake", "0", "/", "test", 0, 0)
+	cfg.RetryInterval = time.Millisecond
+	cfg.SendBufferSize = 8
+	cfg.IdempotencyKeyField = "key"
+	c := NewClient(cfg, nil, discardLogger())
+	c.dial = func(ctx context.Context, url string, header http.Header) (wsConn, *http.Response, error) {
+		if dials.Add(1) == 1 {
+			return first, nil, nil
+		}
+		select {
+		case <-redial:
+		case <-ctx.Done():
+			return nil, nil, ctx.Err()
+		}
+		return second, nil, nil
+	}
+	t.Cleanup(c.Stop)
+	startConnected(t, c)
+
+	first.Close()
+	if err := c.SendIdempotent("order-1", map[string]int{"qty": 2}); err != nil {
+		t.Fatalf("SendIdempotent while reconnecting: %v", err)
+	}
+	if n := len(first.Writes()); n != 0 {
+		t.Fatalf("dropped connection recorded %d writes", n)
+	}
+
+	close(redial)
+	waitFor(t, 2*time.Second, func() bool { return len(second.Writes()) == 1 })
+
+	var got struct {
+		Key     string          `json:"key"`
+		Payload json.RawMessage `json:"payload"`
+	}
+	if err := json.Unmarshal(second.Writes()[0].Data, &got); err != nil {
+		t.Fatalf("decode retried message: %v", err)
+	}
+	if got.Key != "order-1" || string(got.Payload) != `{"qty":2}` {
+		t.Fatalf("retried message has key %q payload %s, want order-1 {\"qty\":2}", got.Key, got.Payload)
+	}
+}
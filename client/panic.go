@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+type PanicPolicy int
+
+const (
+	PanicRecover PanicPolicy = iota
+	PanicDisconnect
+	PanicRepanic
+)
+
+func (c *Client) safeHandleMessage(msg []byte) (keep bool) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		err := fmt.Errorf("panic in message handler: %v\n%s", r, debug.Stack())
+		c.logger.Errorf("%v", err)
+		if c.callbacks.OnError != nil {
+			c.callbacks.OnError(err)
+		}
+
+		switch c.config.PanicPolicy {
+		case PanicRepanic:
+			panic(r)
+		case PanicDisconnect:
+			keep = false
+		default:
+			keep = true
+		}
+	}()
+
+	return c.handleMessage(msg)
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"time"
+)
+
+const defaultMaxHeldMessages = 1024
+
+var ErrHeldMessagesFull = errors.New("websocket client: paused message buffer full")
+
+// Pause stops delivering inbound messages. By default the socket is still
+// read so pings and pongs keep flowing, and up to MaxHeldMessages that
+// arrive meanwhile are held in memory until Resume. With PauseStopsReading the read loop
+// blocks instead, so TCP backpressure reaches the server; pongs are not read
+// then either, and a server with a short pong wait may drop the connection.
+func (c *Client) Pause() {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	if c.paused {
+		return
+	}
+	c.paused = true
+	c.resume = make(chan struct{})
+}
+
+// Resume delivers held messages in arrival order, then restarts normal
+// delivery. Held messages are dropped once the client has been stopped.
+func (c *Client) Resume() {
+	c.pauseMu.Lock()
+	if !c.paused {
+		c.pauseMu.Unlock()
+		return
+	}
+	c.paused = false
+	close(c.resume)
+	c.resume = nil
+	held := c.held
+	c.held = nil
+
+	c.deliverMu.Lock()
+	c.pauseMu.Unlock()
+	defer c.deliverMu.Unlock()
+
+	// Stop closes Messages() under deliverMu after cancelling ctx, so the
+	// channel stays open for as long as this check holds.
+	if c.ctx.Err() != nil {
+		return
+	}
+	for _, msg := range held {
+		if !c.safeHandleMessage(msg) {
+			if conn := c.getConn(); conn != nil {
+				conn.Close()
+			}
+			return
+		}
+	}
+}
+
+func (c *Client) IsPaused() bool {
+	c.pauseMu.Lock()
+	defer c.pauseMu.Unlock()
+	return c.paused
+}
+
+func (c *Client) waitIfPaused(conn wsConn) bool {
+	if !c.config.PauseStopsReading {
+		return true
+	}
+
+	c.pauseMu.Lock()
+	resume := c.resume
+	c.pauseMu.Unlock()
+	if resume == nil {
+		return true
+	}
+
+	select {
+	case <-c.ctx.Done():
+		return false
+	case <-resume:
+		conn.SetReadDeadline(time.Now().Add(c.config.ReadTimeout))
+		return true
+	}
+}
+
+// deliver hands msg to safeHandleMessage, or holds a copy while paused.
+// pauseMu is taken before deliverMu here and in Resume, so a message read
+// just after Resume cannot overtake the held ones.
+func (c *Client) deliver(msg []byte) bool {
+	c.pauseMu.Lock()
+	if c.paused {
+		full := len(c.held) >= c.maxHeldMessages()
+		if !full {
+			c.held = append(c.held, bytes.Clone(msg))
+		}
+		c.pauseMu.Unlock()
+		if full {
+			c.recordDelivery(true)
+			if c.callbacks.OnError != nil {
+				c.callbacks.OnError(ErrHeldMessagesFull)
+			}
+		}
+		return true
+	}
+	c.deliverMu.Lock()
+	c.pauseMu.Unlock()
+	defer c.deliverMu.Unlock()
+
+	return c.safeHandleMessage(msg)
+}
+
+func (c *Client) maxHeldMessages() int {
+	if c.config.MaxHeldMessages > 0 {
+		return c.config.MaxHeldMessages
+	}
+	return defaultMaxHeldMessages
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPauseHoldsUpToMaxHeldMessages(t *testing.T) {
+	send := make(chan struct{})
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		<-send
+		for i := 0; i < 5; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprint(i)))
+		}
+		conn.ReadMessage()
+	})
+
+	var (
+		mu       sync.Mutex
+		received []string
+		full     atomic.Int32
+	)
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.MaxHeldMessages = 3
+	}, &ClientCallbacks{
+		OnMessage: func(msg []byte) {
+			mu.Lock()
+			received = append(received, string(msg))
+			mu.Unlock()
+		},
+		OnError: func(err error) {
+			if errors.Is(err, ErrHeldMessagesFull) {
+				full.Add(1)
+			}
+		},
+	})
+	startConnected(t, c)
+
+	c.Pause()
+	close(send)
+	waitFor(t, 2*time.Second, func() bool { return full.Load() == 2 })
+
+	mu.Lock()
+	if len(received) != 0 {
+		t.Fatalf("delivered %v while paused", received)
+	}
+	mu.Unlock()
+
+	c.Resume()
+	mu.Lock()
+	defer mu.Unlock()
+	if fmt.Sprint(received) != "[0 1 2]" {
+		t.Fatalf("Resume delivered %v, want [0 1 2]", received)
+	}
+}
+
+func TestResumeAfterStopDoesNotSendOnClosedChannel(t *testing.T) {
+	send := make(chan struct{})
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		<-send
+		for i := 0; i < 3; i++ {
+			conn.WriteMessage(websocket.TextMessage, []byte(fmt.Sprint(i)))
+		}
+		conn.ReadMessage()
+	})
+
+	// A send on the closed channel would panic inside the recovered handler
+	// and surface here.
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.MessageBufferSize = 8
+	}, &ClientCallbacks{
+		OnError: func(err error) { t.Errorf("OnError(%v)", err) },
+	})
+	startConnected(t, c)
+
+	c.Pause()
+	close(send)
+	waitFor(t, 2*time.Second, func() bool {
+		c.pauseMu.Lock()
+		defer c.pauseMu.Unlock()
+		return len(c.held) == 3
+	})
+
+	c.Stop()
+	c.Resume()
+	for msg := range c.Messages() {
+		t.Fatalf("held message %q delivered after Stop", msg)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// pingServer pings each client once with "hello" and reports whether a
+// matching pong arrived within 500ms.
+func pingServer(t *testing.T) (addr string, ponged <-chan bool) {
+	t.Helper()
+
+	result := make(chan bool, 1)
+	addr = newTestServer(t, nil, func(conn *websocket.Conn) {
+		got := make(chan struct{}, 1)
+		conn.SetPongHandler(func(appData string) error {
+			if appData == "hello" {
+				got <- struct{}{}
+			}
+			return nil
+		})
+		conn.WriteControl(websocket.PingMessage, []byte("hello"), time.Now().Add(time.Second))
+		conn.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+		conn.ReadMessage()
+
+		select {
+		case result <- len(got) > 0:
+		default:
+		}
+	})
+	return addr, result
+}
+
+func TestOnPingAndAutoPong(t *testing.T) {
+	addr, ponged := pingServer(t)
+
+	pings := make(chan string, 1)
+	c := newTestClient(t, addr, nil, &ClientCallbacks{
+		OnPing: func(appData string) { pings <- appData },
+	})
+	c.Start()
+
+	select {
+	case data := <-pings:
+		if data != "hello" {
+			t.Fatalf("OnPing(%q), want hello", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnPing not called")
+	}
+	if !<-ponged {
+		t.Fatal("server got no pong with the default config")
+	}
+}
+
+func TestDisableAutoPong(t *testing.T) {
+	addr, ponged := pingServer(t)
+
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.DisableAutoPong = true
+	}, nil)
+	c.Start()
+
+	if <-ponged {
+		t.Fatal("client answered a ping with DisableAutoPong set")
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"crypto/x509"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newConnectProxy starts an HTTP proxy that tunnels CONNECT requests and
+// reports each requested host on connects.
+func newConnectProxy(t *testing.T) (proxyURL string, connects <-chan string) {
+	t.Helper()
+
+	hosts := make(chan string, 16)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodConnect {
+			http.Error(w, "CONNECT only", http.StatusMethodNotAllowed)
+			return
+		}
+		hosts <- r.Host
+
+		upstream, err := net.Dial("tcp", r.Host)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		defer upstream.Close()
+		downstream, _, err := http.NewResponseController(w).Hijack()
+		if err != nil {
+			return
+		}
+		defer downstream.Close()
+
+		io.WriteString(downstream, "HTTP/1.1 200 Connection established\r\n\r\n")
+		go io.Copy(upstream, downstream)
+		io.Copy(downstream, upstream)
+	}))
+	t.Cleanup(ts.Close)
+	return ts.URL, hosts
+}
+
+func TestProxyTunnelsConnection(t *testing.T) {
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		_, msg, err := conn.ReadMessage()
+		if err != nil {
+			return
+		}
+		conn.WriteMessage(websocket.TextMessage, msg)
+		conn.ReadMessage()
+	})
+	proxyURL, connects := newConnectProxy(t)
+
+	messages := make(chan string, 1)
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		if err := cfg.SetProxyURL(proxyURL); err != nil {
+			t.Fatalf("SetProxyURL: %v", err)
+		}
+	}, &ClientCallbacks{
+		OnMessage: func(msg []byte) { messages <- string(msg) },
+	})
+	startConnected(t, c)
+
+	if host := <-connects; host != addr {
+		t.Fatalf("proxy got CONNECT %s, want %s", host, addr)
+	}
+	if err := c.Send("through the proxy"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case got := <-messages:
+		if got != `"through the proxy"` {
+			t.Fatalf("echo %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no echo through the proxy")
+	}
+}
+
+func TestProxyTunnelsTLS(t *testing.T) {
+	ts := httptest.NewTLSServer(http.NotFoundHandler())
+	t.Cleanup(ts.Close)
+	addr := ts.Listener.Addr().String()
+	proxyURL, connects := newConnectProxy(t)
+
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.Scheme = "wss"
+		cfg.SetProxyURL(proxyURL)
+	}, nil)
+	url, err := c.config.dialURL(c.config.endpoints()[0])
+	if err != nil {
+		t.Fatalf("dialURL: %v", err)
+	}
+
+	// The test server's certificate is self-signed, so reaching it through
+	// the tunnel shows up as an unknown authority rather than a proxy or
+	// dial error.
+	_, _, err = c.dialWebsocket(t.Context(), url, nil)
+	var unknownCA x509.UnknownAuthorityError
+	if !errors.As(err, &unknownCA) {
+		t.Fatalf("dial through proxy: %v, want the server's certificate to be checked", err)
+	}
+	if host := <-connects; host != addr {
+		t.Fatalf("proxy got CONNECT %s, want %s", host, addr)
+	}
+}
+
+func TestSetProxyURLRejectsInvalidURL(t *testing.T) {
+	cfg := NewClientConfig("ws", "localhost", "0", "/", "test", 0, 0)
+	if err := cfg.SetProxyURL("http://[::1"); err == nil {
+		t.Fatal("SetProxyURL accepted an invalid URL")
+	}
+	if cfg.Proxy != nil {
+		t.Fatal("invalid proxy URL was installed")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestQueryReachesServer(t *testing.T) {
+	queries := make(chan url.Values, 1)
+	upgrader := websocket.Upgrader{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case queries <- r.URL.Query():
+		default:
+		}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.ReadMessage()
+	}))
+	t.Cleanup(ts.Close)
+
+	c := newTestClient(t, ts.Listener.Addr().String(), func(cfg *ClientConfig) {
+		cfg.Path = "/ws?existing=1"
+		cfg.Query = url.Values{
+			"token": {"a b&c=d/é"},
+			"tag":   {"x", "y"},
+		}
+	}, nil)
+	c.Start()
+
+	want := url.Values{
+		"existing": {"1"},
+		"token":    {"a b&c=d/é"},
+		"tag":      {"x", "y"},
+	}
+	select {
+	case got := <-queries:
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("server saw query %v, want %v", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("client never dialed")
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrRateLimited = errors.New("websocket client: send rate limited")
+
+type RateLimitMode int
+
+const (
+	RateLimitBlock RateLimitMode = iota
+	RateLimitDrop
+)
+
+type sendLimiter struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (c *Client) waitSendToken(ctx context.Context) error {
+	rate := c.config.SendRateLimit
+	if rate <= 0 {
+		return nil
+	}
+	burst := float64(max(c.config.SendBurst, 1))
+
+	l := &c.sendLimiter
+	l.mu.Lock()
+	now := time.Now()
+	if l.last.IsZero() {
+		l.tokens = burst
+	} else {
+		l.tokens = min(burst, l.tokens+now.Sub(l.last).Seconds()*rate)
+	}
+	l.last = now
+
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+	if c.config.RateLimitMode == RateLimitDrop {
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+
+	wait := time.Duration((1 - l.tokens) / rate * float64(time.Second))
+	l.tokens--
+	l.mu.Unlock()
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-c.ctx.Done():
+		l.refund()
+		return c.ctx.Err()
+	case <-ctx.Done():
+		l.refund()
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// refund returns a token reserved by a wait that was abandoned, so it does
+// not delay later sends.
+func (l *sendLimiter) refund() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens++
+}
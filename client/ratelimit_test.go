@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"websocket/wstest"
+)
+
+func TestSendRateLimitDropMode(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	c := newFakeClient(t, conn, func(cfg *ClientConfig) {
+		cfg.SendRateLimit = 10
+		cfg.SendBurst = 3
+		cfg.RateLimitMode = RateLimitDrop
+	}, nil)
+
+	for i := 0; i < 3; i++ {
+		if err := c.Send(i); err != nil {
+			t.Fatalf("send %d within burst: %v", i, err)
+		}
+	}
+	if err := c.Send(3); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("send past burst = %v, want ErrRateLimited", err)
+	}
+	if n := len(conn.Writes()); n != 3 {
+		t.Fatalf("wrote %d messages, want 3", n)
+	}
+
+	time.Sleep(120 * time.Millisecond)
+	if err := c.Send(4); err != nil {
+		t.Fatalf("send after refill: %v", err)
+	}
+}
+
+func TestSendRateLimitBlockMode(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	c := newFakeClient(t, conn, func(cfg *ClientConfig) {
+		cfg.SendRateLimit = 20
+		cfg.SendBurst = 2
+	}, nil)
+
+	start := time.Now()
+	for i := 0; i < 5; i++ {
+		if err := c.Send(i); err != nil {
+			t.Fatalf("send %d: %v", i, err)
+		}
+	}
+	// Two sends use the burst; the other three wait 50ms each.
+	if elapsed := time.Since(start); elapsed < 140*time.Millisecond {
+		t.Fatalf("5 sends took %v, want at least 150ms at 20/s with burst 2", elapsed)
+	}
+	if n := len(conn.Writes()); n != 5 {
+		t.Fatalf("wrote %d messages, want 5", n)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := c.SendContext(ctx, "late"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("SendContext waiting for a token = %v, want DeadlineExceeded", err)
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+// SetReconnect enables or disables re-dialing at runtime. While disabled, a
+// dropped connection still fires OnDisconnect but the client parks until
+// reconnection is enabled again, with a fresh backoff, or Stop is called.
+func (c *Client) SetReconnect(enabled bool) {
+	c.reconnectMu.Lock()
+	defer c.reconnectMu.Unlock()
+
+	if enabled == !c.reconnectOff.Load() {
+		return
+	}
+	if enabled {
+		c.reconnectOff.Store(false)
+		close(c.reconnectOn)
+		c.reconnectOn = nil
+	} else {
+		c.reconnectOn = make(chan struct{})
+		c.reconnectOff.Store(true)
+	}
+}
+
+// awaitReconnect blocks while reconnection is disabled. It returns false if
+// the client is stopped first.
+func (c *Client) awaitReconnect() bool {
+	if !c.reconnectOff.Load() {
+		return true
+	}
+
+	c.reconnectMu.Lock()
+	enabled := c.reconnectOn
+	c.reconnectMu.Unlock()
+	if enabled == nil {
+		return true
+	}
+
+	c.logger.Infof("Reconnection disabled, waiting")
+	select {
+	case <-c.ctx.Done():
+		return false
+	case <-enabled:
+		c.retryCount = 0
+		c.flapCount = 0
+		return true
+	}
+}
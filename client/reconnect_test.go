@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectOnMessage(t *testing.T) {
+	var connections atomic.Int32
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		if connections.Add(1) == 1 {
+			conn.WriteMessage(websocket.TextMessage, []byte(`"reconnect"`))
+		}
+		conn.ReadMessage()
+	})
+
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.ReconnectOnMessage = func(msg []byte) bool { return string(msg) == `"reconnect"` }
+	}, nil)
+	c.Start()
+
+	waitFor(t, 2*time.Second, func() bool { return connections.Load() == 2 })
+}
+
+func TestReconnectOnMessageIgnoresUnverifiedMessages(t *testing.T) {
+	secret := []byte("shared secret")
+	signer := &ClientConfig{HMACSecret: secret}
+	payload := []byte(`"reconnect"`)
+	signed, _ := json.Marshal(map[string]any{
+		"payload": json.RawMessage(payload),
+		"hmac":    signer.computeHMAC(payload),
+	})
+	forged, _ := json.Marshal(map[string]any{
+		"payload": json.RawMessage(payload),
+		"hmac":    "00",
+	})
+
+	var connections atomic.Int32
+	sendSigned := make(chan struct{})
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		if connections.Add(1) == 1 {
+			conn.WriteMessage(websocket.TextMessage, forged)
+			conn.WriteMessage(websocket.TextMessage, []byte(`"reconnect"`))
+			<-sendSigned
+			conn.WriteMessage(websocket.TextMessage, signed)
+		}
+		conn.ReadMessage()
+	})
+
+	var rejected atomic.Int32
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.HMACSecret = secret
+		cfg.ReconnectOnMessage = func(msg []byte) bool { return string(msg) == `"reconnect"` }
+	}, &ClientCallbacks{
+		OnError: func(err error) { rejected.Add(1) },
+	})
+	c.Start()
+
+	waitFor(t, 2*time.Second, func() bool { return rejected.Load() == 2 })
+	if n := connections.Load(); n != 1 {
+		t.Fatalf("unverified messages caused a reconnect (%d connections)", n)
+	}
+
+	close(sendSigned)
+	waitFor(t, 2*time.Second, func() bool { return connections.Load() == 2 })
+}
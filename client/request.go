@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+)
+
+type requestEnvelope struct {
+	ID      string      `json:"id"`
+	Payload interface{} `json:"payload"`
+}
+
+func defaultCorrelationExtractor(msg []byte) (string, bool) {
+	var envelope struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(msg, &envelope); err != nil || envelope.ID == "" {
+		return "", false
+	}
+	return envelope.ID, true
+}
+
+func (c *Client) Request(ctx context.Context, msg interface{}) ([]byte, error) {
+	id := c.nextID()
+	return c.roundTrip(ctx, id, requestEnvelope{ID: id, Payload: msg})
+}
+
+// roundTrip sends msg and waits for the inbound message whose correlation
+// ID is id.
+func (c *Client) roundTrip(ctx context.Context, id string, msg interface{}) ([]byte, error) {
+	reply := make(chan []byte, 1)
+	c.pendingMu.Lock()
+	c.pending[id] = reply
+	c.pendingMu.Unlock()
+
+	defer func() {
+		c.pendingMu.Lock()
+		delete(c.pending, id)
+		c.pendingMu.Unlock()
+	}()
+
+	if err := c.SendContext(ctx, msg); err != nil {
+		return nil, err
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case resp := <-reply:
+		return resp, nil
+	}
+}
+
+func (c *Client) resolvePending(msg []byte) bool {
+	extract := c.config.CorrelationExtractor
+	if extract == nil {
+		extract = defaultCorrelationExtractor
+	}
+
+	c.pendingMu.Lock()
+	if len(c.pending) == 0 {
+		c.pendingMu.Unlock()
+		return false
+	}
+	c.pendingMu.Unlock()
+
+	id, ok := extract(msg)
+	if !ok {
+		return false
+	}
+
+	c.pendingMu.Lock()
+	reply, ok := c.pending[id]
+	if ok {
+		delete(c.pending, id)
+	}
+	c.pendingMu.Unlock()
+
+	if !ok {
+		return false
+	}
+	if c.callbacks.OnMessageBuffered != nil {
+		msg = bytes.Clone(msg)
+	}
+	reply <- msg
+	return true
+}
+
+func (c *Client) nextID() string {
+	if c.config.IDGenerator != nil {
+		return c.config.IDGenerator()
+	}
+	return newCorrelationID()
+}
+
+func newCorrelationID() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestRequestUsesIDGenerator(t *testing.T) {
+	ids := make(chan string, 2)
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		for {
+			var req struct {
+				ID      string `json:"id"`
+				Payload string `json:"payload"`
+			}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			ids <- req.ID
+			conn.WriteJSON(map[string]string{"id": req.ID, "reply": req.Payload})
+		}
+	})
+
+	var n int
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.IDGenerator = func() string {
+			n++
+			return fmt.Sprintf("req-%d", n)
+		}
+	}, nil)
+	startConnected(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	for _, want := range []string{"req-1", "req-2"} {
+		reply, err := c.Request(ctx, "hello")
+		if err != nil {
+			t.Fatalf("Request: %v", err)
+		}
+		if got := <-ids; got != want {
+			t.Fatalf("sent id %q, want %q", got, want)
+		}
+		var resp map[string]string
+		json.Unmarshal(reply, &resp)
+		if resp["id"] != want || resp["reply"] != "hello" {
+			t.Fatalf("reply %s, want id %s", reply, want)
+		}
+	}
+}
+
+func TestCallSharesIDsWithRequest(t *testing.T) {
+	ids := make(chan string, 2)
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		for {
+			var req struct {
+				ID     string `json:"id"`
+				Method string `json:"method"`
+			}
+			if err := conn.ReadJSON(&req); err != nil {
+				return
+			}
+			ids <- req.ID
+			if req.Method != "" {
+				conn.WriteJSON(map[string]any{"jsonrpc": "2.0", "id": req.ID, "result": req.Method})
+			} else {
+				conn.WriteJSON(map[string]string{"id": req.ID})
+			}
+		}
+	})
+
+	var n int
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.IDGenerator = func() string {
+			n++
+			return fmt.Sprintf("req-%d", n)
+		}
+	}, nil)
+	startConnected(t, c)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if _, err := c.Request(ctx, "hello"); err != nil {
+		t.Fatalf("Request: %v", err)
+	}
+	if got := <-ids; got != "req-1" {
+		t.Fatalf("Request sent id %q, want req-1", got)
+	}
+	result, err := c.Call(ctx, "ping", nil)
+	if err != nil {
+		t.Fatalf("Call: %v", err)
+	}
+	if got := <-ids; got != "req-2" {
+		t.Fatalf("Call sent id %q, want req-2 from IDGenerator", got)
+	}
+	if string(result) != `"ping"` {
+		t.Fatalf("Call result %s, want \"ping\"", result)
+	}
+}
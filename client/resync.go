@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+)
+
+var ErrNoSyncMarker = errors.New("websocket client: no sync marker configured")
+
+// Resync discards inbound frames until one starting with SyncMarker arrives.
+// That frame and everything after it are dispatched normally.
+func (c *Client) Resync() error {
+	if len(c.config.SyncMarker) == 0 {
+		return ErrNoSyncMarker
+	}
+	c.resyncing.Store(true)
+	return nil
+}
+
+func (c *Client) skipUntilSync(msg []byte) bool {
+	if !c.resyncing.Load() {
+		return false
+	}
+	if bytes.HasPrefix(msg, c.config.SyncMarker) {
+		c.resyncing.Store(false)
+		c.logger.Infof("Resynchronized on sync marker")
+		return false
+	}
+	return true
+}
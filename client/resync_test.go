@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+func TestResyncSkipsUntilSyncMarker(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	messages := make(chan []byte, 4)
+	marker := []byte{0xAA, 0x55}
+
+	var c *Client
+	c = newFakeClient(t, conn, func(cfg *ClientConfig) {
+		cfg.SyncMarker = marker
+	}, &ClientCallbacks{
+		OnMessage: func(msg []byte) {
+			// A frame without a length header means the stream is out of
+			// step; resync rather than decode garbage.
+			if len(msg) > 0 && msg[0] == 0xFF {
+				c.Resync()
+				return
+			}
+			messages <- msg
+		},
+	})
+
+	frames := [][]byte{
+		{0xFF, 0x01},                 // desync detected
+		{0x03, 'b', 'a', 'd'},        // skipped
+		{0x02, 'n', 'o'},             // skipped
+		{0xAA, 0x55, 0x02, 'o', 'k'}, // sync marker, delivered
+		{0x04, 'n', 'e', 'x', 't'},   // delivered normally
+	}
+	for _, frame := range frames {
+		conn.QueueRead(websocket.BinaryMessage, frame)
+	}
+
+	for _, want := range [][]byte{frames[3], frames[4]} {
+		select {
+		case got := <-messages:
+			if !bytes.Equal(got, want) {
+				t.Fatalf("delivered %v, want %v", got, want)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("frame %v not delivered", want)
+		}
+	}
+}
+
+func TestResyncWithoutMarker(t *testing.T) {
+	c := newFakeClient(t, wstest.NewFakeConn(), nil, nil)
+	if err := c.Resync(); !errors.Is(err, ErrNoSyncMarker) {
+		t.Fatalf("Resync() = %v, want ErrNoSyncMarker", err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+type ReconnectStats struct {
+	TotalReconnects int
+	TotalDowntime   time.Duration
+	LongestOutage   time.Duration
+	CurrentUptime   time.Duration
+}
+
+type reconnectTracker struct {
+	mu             sync.Mutex
+	stats          ReconnectStats
+	connectedAt    time.Time
+	disconnectedAt time.Time
+}
+
+func (t *reconnectTracker) connected(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if !t.disconnectedAt.IsZero() {
+		outage := now.Sub(t.disconnectedAt)
+		t.stats.TotalReconnects++
+		t.stats.TotalDowntime += outage
+		if outage > t.stats.LongestOutage {
+			t.stats.LongestOutage = outage
+		}
+		t.disconnectedAt = time.Time{}
+	}
+	t.connectedAt = now
+}
+
+func (t *reconnectTracker) disconnected(now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.connectedAt.IsZero() {
+		return
+	}
+	t.connectedAt = time.Time{}
+	t.disconnectedAt = now
+}
+
+func (c *Client) ReconnectStats() ReconnectStats {
+	c.reconnects.mu.Lock()
+	defer c.reconnects.mu.Unlock()
+
+	stats := c.reconnects.stats
+	if !c.reconnects.connectedAt.IsZero() {
+		stats.CurrentUptime = time.Since(c.reconnects.connectedAt)
+	}
+	return stats
+}
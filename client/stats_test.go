@@ -0,0 +1,66 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestReconnectStatsAccumulate(t *testing.T) {
+	c := &Client{}
+	t0 := time.Now().Add(-time.Hour)
+	cycles := []struct {
+		up, down time.Duration // offsets from t0
+	}{
+		{0, 10 * time.Second},
+		{12 * time.Second, 20 * time.Second},
+		{25 * time.Second, 30 * time.Second},
+		{31 * time.Second, -1},
+	}
+	for _, cycle := range cycles {
+		c.reconnects.connected(t0.Add(cycle.up))
+		if cycle.down >= 0 {
+			c.reconnects.disconnected(t0.Add(cycle.down))
+		}
+	}
+
+	stats := c.ReconnectStats()
+	if stats.TotalReconnects != 3 {
+		t.Errorf("TotalReconnects = %d, want 3", stats.TotalReconnects)
+	}
+	if stats.TotalDowntime != 8*time.Second {
+		t.Errorf("TotalDowntime = %v, want 8s", stats.TotalDowntime)
+	}
+	if stats.LongestOutage != 5*time.Second {
+		t.Errorf("LongestOutage = %v, want 5s", stats.LongestOutage)
+	}
+	if want := time.Since(t0.Add(31 * time.Second)); stats.CurrentUptime < want-time.Second || stats.CurrentUptime > want {
+		t.Errorf("CurrentUptime = %v, want about %v", stats.CurrentUptime, want)
+	}
+
+	c.reconnects.disconnected(time.Now())
+	if stats := c.ReconnectStats(); stats.CurrentUptime != 0 {
+		t.Errorf("CurrentUptime = %v while disconnected, want 0", stats.CurrentUptime)
+	}
+}
+
+func TestReconnectStatsCountReconnects(t *testing.T) {
+	var connections atomic.Int32
+	addr := newTestServer(t, nil, func(conn *websocket.Conn) {
+		if connections.Add(1) <= 3 {
+			return
+		}
+		conn.ReadMessage()
+	})
+
+	c := newTestClient(t, addr, nil, nil)
+	c.Start()
+
+	waitFor(t, 2*time.Second, func() bool { return c.ReconnectStats().TotalReconnects == 3 })
+	stats := c.ReconnectStats()
+	if stats.TotalDowntime <= 0 || stats.LongestOutage <= 0 || stats.LongestOutage > stats.TotalDowntime {
+		t.Fatalf("TotalDowntime %v, LongestOutage %v", stats.TotalDowntime, stats.LongestOutage)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// SendStream writes everything read from r as one message, letting the
+// connection fragment it instead of buffering r in memory. writeMu is held
+// until the final frame is written, and WriteTimeout applies to each chunk.
+// If reading r or writing a chunk fails, the message cannot be finished, so
+// the connection is dropped and the client reconnects.
+func (c *Client) SendStream(r io.Reader, messageType int) error {
+	defer c.startSpan("websocket.send_stream")()
+
+	if err := c.waitSendToken(context.Background()); err != nil {
+		return err
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+
+	if c.stopping.Load() {
+		return ErrStopping
+	}
+	conn := c.getConn()
+	if conn == nil {
+		return ErrNotConnected
+	}
+	if err := c.flushOutboxLocked(conn); err != nil {
+		return err
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+	w, err := conn.NextWriter(messageType)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(&deadlineWriter{conn: conn, w: w, timeout: c.config.WriteTimeout}, r); err != nil {
+		// Closing w would send what was copied so far as a complete
+		// message. Drop the connection instead so the peer never sees the
+		// truncated payload, as writeFrame does for failed writes.
+		c.markDisconnect(DisconnectWriteError)
+		conn.Close()
+		return err
+	}
+	conn.SetWriteDeadline(time.Now().Add(c.config.WriteTimeout))
+	if err := w.Close(); err != nil {
+		return err
+	}
+	conn.SetWriteDeadline(time.Time{})
+	return nil
+}
+
+type deadlineWriter struct {
+	conn    wsConn
+	w       io.Writer
+	timeout time.Duration
+}
+
+func (d *deadlineWriter) Write(p []byte) (int, error) {
+	d.conn.SetWriteDeadline(time.Now().Add(d.timeout))
+	return d.w.Write(p)
+}
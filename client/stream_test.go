@@ -0,0 +1,43 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+func TestSendStream(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	c := newFakeClient(t, conn, nil, nil)
+
+	if err := c.SendStream(strings.NewReader("streamed payload"), websocket.BinaryMessage); err != nil {
+		t.Fatalf("SendStream: %v", err)
+	}
+	writes := conn.Writes()
+	if len(writes) != 1 || writes[0].Type != websocket.BinaryMessage || string(writes[0].Data) != "streamed payload" {
+		t.Fatalf("writes = %+v, want one binary message", writes)
+	}
+}
+
+func TestSendStreamReadErrorDropsConnection(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	c := newFakeClient(t, conn, nil, nil)
+
+	errBoom := errors.New("boom")
+	r := io.MultiReader(strings.NewReader("partial"), iotest.ErrReader(errBoom))
+	if err := c.SendStream(r, websocket.TextMessage); !errors.Is(err, errBoom) {
+		t.Fatalf("SendStream = %v, want the reader's error", err)
+	}
+	if writes := conn.Writes(); len(writes) != 0 {
+		t.Fatalf("truncated message was finalized: %+v", writes)
+	}
+	if !conn.Closed() {
+		t.Fatal("connection left open after a partial message")
+	}
+}
@@ -0,0 +1,23 @@
+package main
+
+import "context"
+
+type Tracer interface {
+	StartSpan(ctx context.Context, name string) (context.Context, func())
+}
+
+func (c *Client) startSpan(name string) func() {
+	if c.config.Tracer == nil {
+		return func() {}
+	}
+
+	parent := c.config.TraceContext
+	if parent == nil {
+		parent = context.Background()
+	}
+	_, end := c.config.Tracer.StartSpan(parent, name)
+	if end == nil {
+		return func() {}
+	}
+	return end
+}
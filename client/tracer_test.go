@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+type traceKey struct{}
+
+// mockTracer records each span's name, whether it ended, and the trace
+// value found on its parent context.
+type mockTracer struct {
+	mu    sync.Mutex
+	spans []*mockSpan
+}
+
+type mockSpan struct {
+	name   string
+	parent any
+	ended  bool
+}
+
+func (m *mockTracer) StartSpan(ctx context.Context, name string) (context.Context, func()) {
+	span := &mockSpan{name: name, parent: ctx.Value(traceKey{})}
+	m.mu.Lock()
+	m.spans = append(m.spans, span)
+	m.mu.Unlock()
+	return ctx, func() {
+		m.mu.Lock()
+		span.ended = true
+		m.mu.Unlock()
+	}
+}
+
+// ended returns the names of finished spans in start order.
+func (m *mockTracer) ended() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var names []string
+	for _, span := range m.spans {
+		if span.ended {
+			names = append(names, span.name)
+		}
+	}
+	return names
+}
+
+func TestTracerSpans(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	tracer := &mockTracer{}
+
+	c := newFakeClient(t, conn, func(cfg *ClientConfig) {
+		cfg.Tracer = tracer
+		cfg.TraceContext = context.WithValue(context.Background(), traceKey{}, "trace-1")
+	}, nil)
+
+	if err := c.Send("hello"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	conn.QueueRead(websocket.TextMessage, []byte("world"))
+
+	want := []string{"websocket.connect", "websocket.send", "websocket.receive"}
+	waitFor(t, time.Second, func() bool { return len(tracer.ended()) == len(want) })
+	if got := tracer.ended(); !slices.Equal(got, want) {
+		t.Fatalf("spans %v, want %v", got, want)
+	}
+	tracer.mu.Lock()
+	defer tracer.mu.Unlock()
+	for _, span := range tracer.spans {
+		if span.parent != "trace-1" {
+			t.Errorf("span %s not started under TraceContext", span.name)
+		}
+	}
+}
+
+func TestNilTracerIsNoop(t *testing.T) {
+	conn := wstest.NewFakeConn()
+	c := newFakeClient(t, conn, nil, nil)
+	if err := c.Send("hello"); err != nil {
+		t.Fatalf("Send without a tracer: %v", err)
+	}
+}
@@ -0,0 +1,27 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+func SendTyped[T any](c *Client, v T) error {
+	return c.Send(v)
+}
+
+// OnTyped installs an OnMessage handler that decodes each message into T.
+// Messages that fail to decode are reported to OnError and not passed to fn.
+func OnTyped[T any](c *Client, fn func(T)) {
+	c.OnMessage(func(msg []byte) {
+		var v T
+		if err := json.Unmarshal(msg, &v); err != nil {
+			err = fmt.Errorf("websocket client: decode %T: %w", v, err)
+			c.logger.Warnf("%v", err)
+			if c.callbacks.OnError != nil {
+				c.callbacks.OnError(err)
+			}
+			return
+		}
+		fn(v)
+	})
+}
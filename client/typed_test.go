@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"websocket/wstest"
+)
+
+type typedEvent struct {
+	Name  string   `json:"name"`
+	Count int      `json:"count"`
+	Tags  []string `json:"tags"`
+}
+
+func TestTypedStruct(t *testing.T) {
+	addr, _ := wstest.NewEchoServer(t)
+	errs := make(chan error, 1)
+	c := newTestClient(t, addr, nil, &ClientCallbacks{
+		OnError: func(err error) { errs <- err },
+	})
+	events := make(chan typedEvent, 1)
+	OnTyped(c, func(ev typedEvent) { events <- ev })
+	startConnected(t, c)
+
+	want := typedEvent{Name: "deploy", Count: 3, Tags: []string{"canary"}}
+	if err := SendTyped(c, want); err != nil {
+		t.Fatalf("SendTyped: %v", err)
+	}
+	select {
+	case got := <-events:
+		if got.Name != want.Name || got.Count != want.Count || !slices.Equal(got.Tags, want.Tags) {
+			t.Fatalf("OnTyped got %+v, want %+v", got, want)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("typed struct not delivered")
+	}
+
+	// An echoed array cannot decode into the struct.
+	if err := SendTyped(c, []int{1, 2}); err != nil {
+		t.Fatalf("SendTyped: %v", err)
+	}
+	select {
+	case err := <-errs:
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			t.Fatalf("OnError(%v), want a *json.UnmarshalTypeError", err)
+		}
+	case ev := <-events:
+		t.Fatalf("undecodable message delivered as %+v", ev)
+	case <-time.After(2 * time.Second):
+		t.Fatal("decode error not reported")
+	}
+}
+
+func TestTypedSlice(t *testing.T) {
+	addr, _ := wstest.NewEchoServer(t)
+	c := newTestClient(t, addr, nil, nil)
+	batches := make(chan []int, 1)
+	OnTyped(c, func(batch []int) { batches <- batch })
+	startConnected(t, c)
+
+	if err := SendTyped(c, []int{4, 8, 15}); err != nil {
+		t.Fatalf("SendTyped: %v", err)
+	}
+	select {
+	case got := <-batches:
+		if !slices.Equal(got, []int{4, 8, 15}) {
+			t.Fatalf("OnTyped got %v", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("typed slice not delivered")
+	}
+}
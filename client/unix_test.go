@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestNetDialUnixSocket(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "ws.sock")
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	upgrader := websocket.Upgrader{}
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for {
+			messageType, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteMessage(messageType, msg)
+		}
+	})}
+	go srv.Serve(listener)
+	t.Cleanup(func() { srv.Close() })
+
+	messages := make(chan string, 1)
+	c := newTestClient(t, "unix:0", func(cfg *ClientConfig) {
+		cfg.NetDial = func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socketPath)
+		}
+	}, &ClientCallbacks{
+		OnMessage: func(msg []byte) { messages <- string(msg) },
+	})
+	startConnected(t, c)
+
+	if err := c.Send("over unix"); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	select {
+	case got := <-messages:
+		if got != `"over unix"` {
+			t.Fatalf("echo %q", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("no echo over the unix socket")
+	}
+}
@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const protocolVersionHeader = "X-Protocol-Version"
+
+var ErrProtocolMismatch = errors.New("websocket client: protocol version mismatch")
+
+// checkProtocolVersion compares the major component of the version the
+// server advertises against ProtocolVersion. Servers that advertise nothing
+// are accepted.
+func (c *Client) checkProtocolVersion(resp *http.Response) error {
+	if c.config.ProtocolVersion == "" || resp == nil {
+		return nil
+	}
+
+	advertised := resp.Header.Get(protocolVersionHeader)
+	if advertised == "" || majorVersion(advertised) == majorVersion(c.config.ProtocolVersion) {
+		return nil
+	}
+	return fmt.Errorf("%w: client speaks %s, server advertises %s", ErrProtocolMismatch, c.config.ProtocolVersion, advertised)
+}
+
+func majorVersion(version string) string {
+	version = strings.TrimPrefix(strings.TrimSpace(version), "v")
+	major, _, _ := strings.Cut(version, ".")
+	return major
+}
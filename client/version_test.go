@@ -0,0 +1,56 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestProtocolMismatchStopsRetrying(t *testing.T) {
+	var connections atomic.Int32
+	header := http.Header{protocolVersionHeader: {"2.0"}}
+	addr := newTestServer(t, header, func(conn *websocket.Conn) {
+		connections.Add(1)
+		conn.ReadMessage()
+	})
+
+	errs := make(chan error, 4)
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.ProtocolVersion = "1.3"
+	}, &ClientCallbacks{
+		OnConnect: func() { t.Error("connected despite a protocol mismatch") },
+		OnError:   func(err error) { errs <- err },
+	})
+	c.Start()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrProtocolMismatch) {
+			t.Fatalf("OnError(%v), want ErrProtocolMismatch", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("mismatch not reported")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := connections.Load(); n != 1 {
+		t.Fatalf("client dialed %d times, want no retries after a mismatch", n)
+	}
+	if len(errs) != 0 {
+		t.Fatalf("OnError called again: %v", <-errs)
+	}
+}
+
+func TestCompatibleProtocolVersionConnects(t *testing.T) {
+	header := http.Header{protocolVersionHeader: {"v1.9"}}
+	addr := newTestServer(t, header, func(conn *websocket.Conn) { conn.ReadMessage() })
+
+	c := newTestClient(t, addr, func(cfg *ClientConfig) {
+		cfg.ProtocolVersion = "1.3"
+	}, nil)
+	startConnected(t, c)
+}
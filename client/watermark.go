@@ -0,0 +1,35 @@
+package main
+
+// checkWatermark must be called with writeMu held. It returns the callback
+// to run once writeMu is released, so handlers are free to call Send.
+func (c *Client) checkWatermark() func() {
+	capacity := c.config.SendBufferSize
+	if capacity <= 0 {
+		return func() {}
+	}
+
+	high := c.config.BufferHighWater
+	if high <= 0 {
+		high = 0.8
+	}
+	low := c.config.BufferLowWater
+	if low <= 0 || low > high {
+		low = high / 2
+	}
+
+	depth := len(c.outbox)
+	fill := float64(depth) / float64(capacity)
+	switch {
+	case !c.bufferHigh && fill >= high:
+		c.bufferHigh = true
+		if handler := c.callbacks.OnBufferHighWater; handler != nil {
+			return func() { handler(depth, capacity) }
+		}
+	case c.bufferHigh && fill < low:
+		c.bufferHigh = false
+		if handler := c.callbacks.OnBufferLowWater; handler != nil {
+			return func() { handler(depth, capacity) }
+		}
+	}
+	return func() {}
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+var ErrAuditChainBroken = errors.New("audit log hash chain broken")
+
+type auditRecord struct {
+	Time       time.Time `json:"time"`
+	Event      string    `json:"event"`
+	ClientID   string    `json:"client_id,omitempty"`
+	RemoteAddr string    `json:"remote_addr,omitempty"`
+	Detail     string    `json:"detail,omitempty"`
+	PrevHash   string    `json:"prev_hash"`
+	Hash       string    `json:"hash,omitempty"`
+}
+
+// SetAuditLog writes one JSON object per line to w for every connect,
+// disconnect and authentication event. Pass nil to disable.
+//
+// The records form a hash chain so edits, deletions and reordering can be
+// detected. Each record's hash is the hex SHA-256 of the record encoded
+// without its hash field, and prev_hash is the hash of the line before it
+// (empty for the first record written to w). To verify a log, decode each
+// line, check prev_hash against the previous hash, clear hash, re-encode
+// with encoding/json and compare the digest. VerifyAuditLog does this.
+func (s *Server) SetAuditLog(w io.Writer) {
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	s.auditLog = w
+	s.auditHash = ""
+}
+
+func (s *Server) audit(event, clientID, remoteAddr, detail string) {
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+	if s.auditLog == nil {
+		return
+	}
+
+	record := auditRecord{
+		Time:       time.Now().UTC(),
+		Event:      event,
+		ClientID:   clientID,
+		RemoteAddr: remoteAddr,
+		Detail:     detail,
+		PrevHash:   s.auditHash,
+	}
+	hash, err := record.digest()
+	if err != nil {
+		return
+	}
+	record.Hash = hash
+
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+	if _, err := s.auditLog.Write(append(line, '\n')); err != nil {
+		s.logger.Errorf("Audit log write failed: %v", err)
+		return
+	}
+	s.auditHash = hash
+}
+
+func (r auditRecord) digest() (string, error) {
+	r.Hash = ""
+	data, err := json.Marshal(r)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// VerifyAuditLog reads a log written by SetAuditLog and returns an error
+// naming the first line whose hash or chain link does not match.
+func VerifyAuditLog(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	prev := ""
+	for line := 1; ; line++ {
+		var record auditRecord
+		if err := dec.Decode(&record); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("audit log line %d: %w", line, err)
+		}
+
+		if record.PrevHash != prev {
+			return fmt.Errorf("audit log line %d: %w: prev_hash does not match line %d", line, ErrAuditChainBroken, line-1)
+		}
+		hash, err := record.digest()
+		if err != nil {
+			return fmt.Errorf("audit log line %d: %w", line, err)
+		}
+		if hash != record.Hash {
+			return fmt.Errorf("audit log line %d: %w: record was modified", line, ErrAuditChainBroken)
+		}
+		prev = record.Hash
+	}
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAuditLogHashChain(t *testing.T) {
+	disconnected := make(chan struct{})
+	s, url := newTestServer(t, nil, &WsCallback{
+		OnDisconnect: func(clientID string, err error) { close(disconnected) },
+	})
+	var buf bytes.Buffer
+	s.SetAuditLog(&buf)
+
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+	conn.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+
+	written := buf.String()
+	lines := strings.Split(strings.TrimSpace(written), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("audit log has %d lines, want connect and disconnect:\n%s", len(lines), written)
+	}
+	if err := VerifyAuditLog(strings.NewReader(written)); err != nil {
+		t.Fatalf("VerifyAuditLog on an untouched log: %v", err)
+	}
+
+	tampered := strings.Replace(written, `"event":"connect"`, `"event":"auth"`, 1)
+	if err := VerifyAuditLog(strings.NewReader(tampered)); !errors.Is(err, ErrAuditChainBroken) {
+		t.Fatalf("VerifyAuditLog on an edited record = %v, want ErrAuditChainBroken", err)
+	}
+
+	truncated := lines[1] + "\n"
+	if err := VerifyAuditLog(strings.NewReader(truncated)); !errors.Is(err, ErrAuditChainBroken) {
+		t.Fatalf("VerifyAuditLog with the first record removed = %v, want ErrAuditChainBroken", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type broadcastBatch struct {
+	mu      sync.Mutex
+	pending []batchedMessage
+	timer   *time.Timer
+	flushAt time.Time
+}
+
+type batchedMessage struct {
+	data     json.RawMessage
+	deadline time.Time
+}
+
+// BroadcastBatched queues msg and sends it, together with every other
+// message queued within BatchWindow, as a single JSON array frame. The batch
+// is flushed early once it holds MaxBatchSize messages. Batches go out in
+// the order they were queued. Without a BatchWindow it behaves like Broadcast.
+//
+// A DeadlineMessage that would expire before its batch is due flushes the
+// batch immediately, and the frame carries the earliest deadline of the
+// messages in it. Messages that expire before their batch is flushed are
+// dropped and reported to OnError as ErrMessageExpired.
+func (s *Server) BroadcastBatched(msg interface{}) {
+	if s.config.BatchWindow <= 0 {
+		s.Broadcast(msg)
+		return
+	}
+
+	msg, ok := s.transformBroadcast(msg)
+	if !ok {
+		return
+	}
+
+	payload, deadline := unwrapDeadline(msg)
+	if !deadline.IsZero() && !time.Now().Before(deadline) {
+		s.batchExpired(1)
+		return
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		s.logger.Errorf("Broadcast encode error: %v", err)
+		if s.callbacks.OnError != nil {
+			s.callbacks.OnError(err)
+		}
+		return
+	}
+
+	batch := &s.batch
+	batch.mu.Lock()
+	defer batch.mu.Unlock()
+
+	batch.pending = append(batch.pending, batchedMessage{data: data, deadline: deadline})
+	if limit := s.config.MaxBatchSize; limit > 0 && len(batch.pending) >= limit {
+		s.flushBatchLocked()
+		return
+	}
+	if batch.timer == nil {
+		batch.timer = time.AfterFunc(s.config.BatchWindow, s.flushBatch)
+		batch.flushAt = time.Now().Add(s.config.BatchWindow)
+	}
+	if !deadline.IsZero() && deadline.Before(batch.flushAt) {
+		s.flushBatchLocked()
+	}
+}
+
+func (s *Server) flushBatch() {
+	s.batch.mu.Lock()
+	defer s.batch.mu.Unlock()
+	s.flushBatchLocked()
+}
+
+func (s *Server) flushBatchLocked() {
+	batch := &s.batch
+	if batch.timer != nil {
+		batch.timer.Stop()
+		batch.timer = nil
+	}
+	if len(batch.pending) == 0 {
+		return
+	}
+
+	now := time.Now()
+	var (
+		pending  []json.RawMessage
+		deadline time.Time
+		expired  int
+	)
+	for _, item := range batch.pending {
+		if !item.deadline.IsZero() {
+			if !now.Before(item.deadline) {
+				expired++
+				continue
+			}
+			if deadline.IsZero() || item.deadline.Before(deadline) {
+				deadline = item.deadline
+			}
+		}
+		pending = append(pending, item.data)
+	}
+	batch.pending = nil
+	if expired > 0 {
+		s.batchExpired(expired)
+	}
+	if len(pending) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		s.logger.Errorf("Broadcast encode error: %v", err)
+		return
+	}
+	s.broadcastFrame(websocket.TextMessage, data, deadline, pending, nil, false)
+}
+
+func (s *Server) batchExpired(n int) {
+	err := fmt.Errorf("%w: dropped %d batched broadcast message(s)", ErrMessageExpired, n)
+	s.logger.Warnf("%v", err)
+	if s.callbacks.OnError != nil {
+		s.callbacks.OnError(err)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBroadcastBatchedFlushesByDeadline(t *testing.T) {
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.BatchWindow = time.Minute
+	}, nil)
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	s.BroadcastBatched("plain")
+	s.BroadcastBatched(DeadlineMessage{Payload: "urgent", TTL: 50 * time.Millisecond})
+
+	var batch []string
+	readJSON(t, conn, &batch)
+	if len(batch) != 2 || batch[0] != "plain" || batch[1] != "urgent" {
+		t.Fatalf("batch = %q, want [plain urgent] before the deadline", batch)
+	}
+}
+
+func TestBroadcastBatchedDropsExpiredMessages(t *testing.T) {
+	errs := make(chan error, 1)
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.BatchWindow = 20 * time.Millisecond
+	}, &WsCallback{
+		OnError: func(err error) {
+			select {
+			case errs <- err:
+			default:
+			}
+		},
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	s.BroadcastBatched(DeadlineMessage{Payload: "late", Deadline: time.Now().Add(-time.Second)})
+	s.BroadcastBatched("on time")
+
+	var batch []json.RawMessage
+	readJSON(t, conn, &batch)
+	if len(batch) != 1 || string(batch[0]) != `"on time"` {
+		t.Fatalf("batch = %s, want only the unexpired message", batch)
+	}
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrMessageExpired) {
+			t.Fatalf("OnError(%v), want ErrMessageExpired", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expired batched message not reported")
+	}
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+// addQueuedClient registers a client with no writer goroutine, so its send
+// queues only drain when the test reads them.
+func addQueuedClient(s *Server, clientID string, queueSize int) *Client {
+	ctx, cancel := context.WithCancel(s.ctx)
+	client := &Client{
+		ClientID: clientID,
+		wsConn:   wstest.NewFakeConn(),
+		send:     make(chan *outbound, queueSize),
+		sendHigh: make(chan *outbound, queueSize),
+		sendLow:  make(chan *outbound, queueSize),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+	s.clients.Store(clientID, client)
+	return client
+}
+
+func TestBroadcastSyncWaitsForRoom(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	full := addQueuedClient(s, "full", 1)
+	addQueuedClient(s, "idle", 1)
+	full.send <- &outbound{}
+
+	done := make(chan int, 1)
+	go func() { done <- s.BroadcastSync("hello") }()
+
+	select {
+	case n := <-done:
+		t.Fatalf("BroadcastSync returned %d while a queue was full", n)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-full.send
+	select {
+	case n := <-done:
+		if n != 2 {
+			t.Fatalf("BroadcastSync enqueued %d, want 2", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BroadcastSync still blocked after the queue drained")
+	}
+}
+
+func TestBroadcastSyncSkipsDisconnectedClients(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	stuck := addQueuedClient(s, "stuck", 1)
+	addQueuedClient(s, "idle", 1)
+	stuck.send <- &outbound{}
+
+	done := make(chan int, 1)
+	go func() { done <- s.BroadcastSync("hello") }()
+	time.Sleep(20 * time.Millisecond)
+	stuck.cancel()
+
+	select {
+	case n := <-done:
+		if n != 1 {
+			t.Fatalf("BroadcastSync enqueued %d, want 1", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("BroadcastSync blocked on a disconnected client")
+	}
+}
+
+func TestBroadcastBytesSharesOnePreparedFrame(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	a := addQueuedClient(s, "a", 1)
+	b := addQueuedClient(s, "b", 1)
+
+	data := []byte{0x01, 0x02, 0x03}
+	if result := s.BroadcastBytes(websocket.BinaryMessage, data); result.Enqueued != 2 {
+		t.Fatalf("BroadcastBytes enqueued %d, want 2", result.Enqueued)
+	}
+
+	first, second := <-a.send, <-b.send
+	if first.prepared == nil || first.prepared != second.prepared {
+		t.Fatal("clients did not share one prepared frame")
+	}
+	if first.messageType != websocket.BinaryMessage || !bytes.Equal(first.data, data) {
+		t.Fatalf("queued (%d, %v), want the caller's binary bytes", first.messageType, first.data)
+	}
+}
+
+// BenchmarkBroadcast fans one message out to real connections, comparing a
+// per-client SendAsync (marshal and frame per client) with BroadcastBytes
+// (marshal once, one prepared frame for everyone).
+func BenchmarkBroadcast(b *testing.B) {
+	const clients = 50
+	msg := map[string]any{"event": "tick", "values": make([]int, 64)}
+	data, _ := json.Marshal(msg)
+
+	for _, bc := range []struct {
+		name      string
+		broadcast func(s *Server, ids []string)
+	}{
+		{"SendAsync", func(s *Server, ids []string) {
+			for _, id := range ids {
+				s.SendAsync(id, msg)
+			}
+		}},
+		{"BroadcastBytes", func(s *Server, ids []string) {
+			s.BroadcastBytes(websocket.TextMessage, data)
+		}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			s, url := newTestServer(b, func(cfg *WsConfig) {
+				cfg.SendQueueSize = b.N + 1
+			}, nil)
+
+			ids := make([]string, clients)
+			var readers sync.WaitGroup
+			for i := range ids {
+				ids[i] = fmt.Sprintf("client-%d", i)
+				conn := dialTestClient(b, url, ids[i])
+				readers.Add(1)
+				go func() {
+					defer readers.Done()
+					for n := 0; n < b.N; n++ {
+						if _, _, err := conn.ReadMessage(); err != nil {
+							b.Errorf("read %d of %d: %v", n, b.N, err)
+							return
+						}
+					}
+				}()
+			}
+			waitForClients(b, s, ids...)
+
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				bc.broadcast(s, ids)
+			}
+			readers.Wait()
+		})
+	}
+}
+
+// receivers returns the ids of clients with a queued message, draining one
+// message from each.
+func receivers(clients ...*Client) []string {
+	var ids []string
+	for _, c := range clients {
+		select {
+		case <-c.send:
+			ids = append(ids, c.ClientID)
+		default:
+		}
+	}
+	return ids
+}
+
+func TestBroadcastOlderThan(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	old := addQueuedClient(s, "old", 1)
+	old.connectedAt = time.Now().Add(-time.Hour)
+	fresh := addQueuedClient(s, "fresh", 1)
+	fresh.connectedAt = time.Now()
+
+	if result := s.BroadcastOlderThan(time.Minute, "hello"); result.Enqueued != 1 {
+		t.Fatalf("BroadcastOlderThan enqueued %d, want 1", result.Enqueued)
+	}
+	if got := receivers(old, fresh); len(got) != 1 || got[0] != "old" {
+		t.Fatalf("delivered to %v, want [old]", got)
+	}
+}
+
+func TestBroadcastTopic(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	sports := addQueuedClient(s, "sports", 1)
+	both := addQueuedClient(s, "both", 1)
+	none := addQueuedClient(s, "none", 1)
+	s.SetClientTopics("sports", []string{"sports"})
+	s.SetClientTopics("both", []string{"sports", "weather"})
+
+	for _, tc := range []struct {
+		topic string
+		want  []string
+	}{
+		{"sports", []string{"sports", "both"}},
+		{"weather", []string{"both"}},
+		{"news", nil},
+	} {
+		s.BroadcastTopic(tc.topic, "hello")
+		if got := receivers(sports, both, none); fmt.Sprint(got) != fmt.Sprint(tc.want) {
+			t.Errorf("BroadcastTopic(%q) delivered to %v, want %v", tc.topic, got, tc.want)
+		}
+	}
+
+	if err := s.SetClientTopics("missing", []string{"sports"}); err == nil {
+		t.Fatal("SetClientTopics on an unknown client succeeded")
+	}
+}
+
+func TestBroadcastSample(t *testing.T) {
+	const clients = 1000
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	queued := make([]*Client, clients)
+	for i := range queued {
+		queued[i] = addQueuedClient(s, fmt.Sprintf("client-%d", i), 1)
+	}
+
+	s.SeedSampling(42)
+	n := s.BroadcastSample(0.1, "canary")
+	if n < 70 || n > 130 {
+		t.Fatalf("BroadcastSample(0.1) sent to %d of %d clients", n, clients)
+	}
+	if got := len(receivers(queued...)); got != n {
+		t.Fatalf("BroadcastSample reported %d but %d clients received it", n, got)
+	}
+
+	s.SeedSampling(42)
+	if again := s.BroadcastSample(0.1, "canary"); again != n {
+		t.Fatalf("same seed sampled %d clients, then %d", n, again)
+	}
+	receivers(queued...)
+
+	if n := s.BroadcastSample(0, "none"); n != 0 {
+		t.Fatalf("BroadcastSample(0) sent to %d", n)
+	}
+	if n := s.BroadcastSample(1, "all"); n != clients {
+		t.Fatalf("BroadcastSample(1) sent to %d, want %d", n, clients)
+	}
+}
+
+func TestBroadcastBinaryFuncBuildsPerClient(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	a := addQueuedClient(s, "a", 1)
+	b := addQueuedClient(s, "b", 1)
+	skipped := addQueuedClient(s, "skipped", 1)
+	versions := map[string]byte{"a": 3, "b": 7}
+
+	result := s.BroadcastBinaryFunc(func(clientID string) ([]byte, bool) {
+		v, ok := versions[clientID]
+		if !ok {
+			return nil, false
+		}
+		return []byte{v, 10 - v}, true
+	})
+	if result.Enqueued != 2 {
+		t.Fatalf("BroadcastBinaryFunc enqueued %d, want 2", result.Enqueued)
+	}
+
+	for _, tc := range []struct {
+		client *Client
+		want   []byte
+	}{
+		{a, []byte{3, 7}},
+		{b, []byte{7, 3}},
+	} {
+		item := <-tc.client.send
+		if item.messageType != websocket.BinaryMessage || !bytes.Equal(item.data, tc.want) {
+			t.Errorf("client %s got (%d, %v), want binary %v", tc.client.ClientID, item.messageType, item.data, tc.want)
+		}
+	}
+	if got := receivers(skipped); len(got) != 0 {
+		t.Fatal("client skipped by build received a message")
+	}
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/gorilla/websocket"
+)
+
+const maxCloseReasonBytes = 123
+
+var (
+	ErrProtocolViolation    = errors.New("client violated the websocket protocol")
+	ErrMessageQuotaExceeded = errors.New("client exceeded message quota")
+	ErrIdleTimeout          = errors.New("client idle timeout")
+)
+
+func (s *Server) CloseClient(clientID string, code int, reason string) error {
+	if !validCloseCode(code) {
+		return fmt.Errorf("invalid close code: %d", code)
+	}
+
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	s.closeConnectionWithCode(client.ClientID, client.wsConn, code, truncateReason(reason))
+	return nil
+}
+
+// DisconnectWhere closes every client whose metadata matches pred with code
+// and reason, and returns how many were closed.
+func (s *Server) DisconnectWhere(pred func(clientID string, data map[string]any) bool, code int, reason string) (int, error) {
+	if !validCloseCode(code) {
+		return 0, fmt.Errorf("invalid close code: %d", code)
+	}
+	reason = truncateReason(reason)
+
+	var matched []*Client
+	s.clients.Range(func(_, value any) bool {
+		client, ok := value.(*Client)
+		if !ok || client == nil {
+			return true
+		}
+		if pred(client.ClientID, client.info().Metadata) {
+			matched = append(matched, client)
+		}
+		return true
+	})
+
+	var wg sync.WaitGroup
+	for _, client := range matched {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.closeConnectionWithCode(client.ClientID, client.wsConn, code, reason)
+		}()
+	}
+	wg.Wait()
+	return len(matched), nil
+}
+
+// closeWithCause closes client from outside its read loop and records err as
+// the reason the loop reports to OnDisconnect and the audit log.
+func (s *Server) closeWithCause(client *Client, code int, reason string, err error) {
+	client.stateMu.Lock()
+	if client.closeCause == nil {
+		client.closeCause = err
+	}
+	client.stateMu.Unlock()
+
+	s.closeConnectionWithCode(client.ClientID, client.wsConn, code, reason)
+}
+
+func (c *Client) cause() error {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return c.closeCause
+}
+
+func validCloseCode(code int) bool {
+	switch {
+	case code >= 3000 && code <= 4999:
+		return true
+	case code >= websocket.CloseNormalClosure && code <= websocket.CloseTLSHandshake:
+		return code != 1004 && code != websocket.CloseNoStatusReceived &&
+			code != websocket.CloseAbnormalClosure && code != websocket.CloseTLSHandshake
+	default:
+		return false
+	}
+}
+
+func truncateReason(reason string) string {
+	if len(reason) <= maxCloseReasonBytes {
+		return reason
+	}
+	reason = reason[:maxCloseReasonBytes]
+	for !utf8.ValidString(reason) {
+		reason = reason[:len(reason)-1]
+	}
+	return reason
+}
+
+// isProtocolError reports whether a read failed because the client broke the
+// framing rules, e.g. a control frame over 125 bytes. gorilla has already
+// answered those with a 1002 close before returning. It does not export a
+// type for them, so this rules out everything else a read can fail with:
+// peer closes surface as *websocket.CloseError, socket failures as
+// net.Error, and the rest are sentinels for local conditions.
+func isProtocolError(err error) bool {
+	var closeErr *websocket.CloseError
+	var netErr net.Error
+	if errors.As(err, &closeErr) || errors.As(err, &netErr) {
+		return false
+	}
+	for _, local := range []error{
+		io.EOF,
+		io.ErrUnexpectedEOF,
+		net.ErrClosed,
+		websocket.ErrReadLimit,
+		websocket.ErrCloseSent,
+		context.Canceled,
+		context.DeadlineExceeded,
+	} {
+		if errors.Is(err, local) {
+			return false
+		}
+	}
+	return true
+}
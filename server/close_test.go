@@ -0,0 +1,200 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+func TestOversizedControlFrameClosesWithProtocolError(t *testing.T) {
+	disconnected := make(chan error, 1)
+	s, url := newTestServer(t, nil, &WsCallback{
+		OnDisconnect: func(clientID string, err error) { disconnected <- err },
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	// gorilla refuses to write an oversized control frame, so write a masked
+	// 200-byte ping straight to the socket.
+	frame := []byte{0x89, 0x80 | 126, 0, 200, 1, 2, 3, 4}
+	for i := 0; i < 200; i++ {
+		frame = append(frame, 'x'^frame[4+i%4])
+	}
+	if _, err := conn.UnderlyingConn().Write(frame); err != nil {
+		t.Fatalf("write raw frame: %v", err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseProtocolError) {
+		t.Fatalf("read after oversized ping = %v, want close 1002", err)
+	}
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, ErrProtocolViolation) {
+			t.Fatalf("OnDisconnect(%v), want ErrProtocolViolation", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+}
+
+func TestLocalReadErrorIsNotProtocolViolation(t *testing.T) {
+	disconnected := make(chan error, 1)
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), &WsCallback{
+		OnDisconnect: func(clientID string, err error) { disconnected <- err },
+	}, discardLogger())
+	t.Cleanup(s.Shutdown)
+
+	conn := wstest.NewFakeConn()
+	s.reserveConnection()
+	s.serveConn("a", conn, nil)
+	conn.QueueError(websocket.ErrCloseSent)
+
+	select {
+	case err := <-disconnected:
+		if errors.Is(err, ErrProtocolViolation) {
+			t.Fatalf("OnDisconnect(%v), a local error reported as a protocol violation", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+}
+
+func TestDisconnectWhere(t *testing.T) {
+	s, url := newTestServer(t, nil, nil)
+	stale := dialTestClient(t, url, "stale")
+	dialTestClient(t, url, "fresh")
+	waitForClients(t, s, "stale", "fresh")
+	s.SetClientData("stale", "session", "expired")
+	s.SetClientData("fresh", "session", "active")
+
+	n, err := s.DisconnectWhere(func(clientID string, data map[string]any) bool {
+		return data["session"] == "expired"
+	}, 4000, "session expired")
+	if err != nil || n != 1 {
+		t.Fatalf("DisconnectWhere = %d, %v, want 1, nil", n, err)
+	}
+
+	stale.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := stale.ReadMessage(); !websocket.IsCloseError(err, 4000) {
+		t.Fatalf("stale client read %v, want close 4000", err)
+	}
+	if _, ok := s.ClientInfo("fresh"); !ok {
+		t.Fatal("non-matching client was disconnected")
+	}
+}
+
+func TestDisconnectWhereRejectsInvalidCode(t *testing.T) {
+	s, url := newTestServer(t, nil, nil)
+	dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	n, err := s.DisconnectWhere(func(string, map[string]any) bool { return true }, websocket.CloseAbnormalClosure, "")
+	if err == nil || n != 0 {
+		t.Fatalf("DisconnectWhere with code 1006 = %d, %v, want an error", n, err)
+	}
+	if _, ok := s.ClientInfo("a"); !ok {
+		t.Fatal("client disconnected despite the invalid close code")
+	}
+}
+
+func TestMessageQuotaClosesConnection(t *testing.T) {
+	var processed []string
+	disconnected := make(chan error, 1)
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.MaxMessagesPerConnection = 3
+	}, &WsCallback{
+		OnMessage:    func(clientID string, msg []byte) { processed = append(processed, string(msg)) },
+		OnDisconnect: func(clientID string, err error) { disconnected <- err },
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	for _, msg := range []string{"1", "2", "3", "4"} {
+		conn.WriteMessage(websocket.TextMessage, []byte(msg))
+	}
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.ClosePolicyViolation || ce.Text != "message quota exceeded" {
+		t.Fatalf("read past quota = %v, want close 1008 \"message quota exceeded\"", err)
+	}
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, ErrMessageQuotaExceeded) {
+			t.Fatalf("OnDisconnect(%v), want ErrMessageQuotaExceeded", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+	if len(processed) != 3 {
+		t.Fatalf("processed %v, want the first 3 messages", processed)
+	}
+}
+
+func TestRateLimitDisconnectReportsReason(t *testing.T) {
+	disconnected := make(chan error, 1)
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.MessagesPerSecond = 1
+		cfg.BurstSize = 1
+		cfg.RateLimitPolicy = RateLimitDisconnect
+	}, &WsCallback{
+		OnDisconnect: func(clientID string, err error) { disconnected <- err },
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	conn.WriteMessage(websocket.TextMessage, []byte("1"))
+	conn.WriteMessage(websocket.TextMessage, []byte("2"))
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.ClosePolicyViolation || ce.Text != "rate limit exceeded" {
+		t.Fatalf("read after burst = %v, want close 1008 \"rate limit exceeded\"", err)
+	}
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("OnDisconnect(%v), want ErrRateLimited", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+}
+
+func TestIdleTimeoutReportsReason(t *testing.T) {
+	disconnected := make(chan error, 1)
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.IdleTimeout = 100 * time.Millisecond
+	}, &WsCallback{
+		OnDisconnect: func(clientID string, err error) { disconnected <- err },
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	var ce *websocket.CloseError
+	if !errors.As(err, &ce) || ce.Code != websocket.CloseNormalClosure || ce.Text != "idle timeout" {
+		t.Fatalf("read while idle = %v, want close 1000 \"idle timeout\"", err)
+	}
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, ErrIdleTimeout) {
+			t.Fatalf("OnDisconnect(%v), want ErrIdleTimeout", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+func TestServeConnWithFakeConn(t *testing.T) {
+	messages := make(chan string, 1)
+	disconnected := make(chan string, 1)
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), &WsCallback{
+		OnMessage:    func(clientID string, msg []byte) { messages <- clientID + ":" + string(msg) },
+		OnDisconnect: func(clientID string, err error) { disconnected <- clientID },
+	}, discardLogger())
+	t.Cleanup(s.Shutdown)
+
+	conn := wstest.NewFakeConn()
+	s.reserveConnection()
+	s.serveConn("a", conn, nil)
+
+	conn.QueueRead(websocket.TextMessage, []byte("hello"))
+	select {
+	case got := <-messages:
+		if got != "a:hello" {
+			t.Fatalf("OnMessage got %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnMessage not called")
+	}
+	if got := conn.ReadLimit(); got != int64(s.config.MaxReadMessageSize) {
+		t.Errorf("read limit = %d, want MaxReadMessageSize", got)
+	}
+
+	if err := s.Send("a", map[string]int{"n": 1}); err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+	writes := conn.Writes()
+	if len(writes) != 1 || writes[0].Type != websocket.TextMessage || string(writes[0].Data) != `{"n":1}` {
+		t.Fatalf("writes = %+v, want one text frame {\"n\":1}", writes)
+	}
+
+	conn.QueueClose(websocket.CloseGoingAway, "bye")
+	select {
+	case id := <-disconnected:
+		if id != "a" {
+			t.Fatalf("OnDisconnect client = %q", id)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+	waitFor(t, time.Second, conn.Closed)
+	if _, ok := s.ClientInfo("a"); ok {
+		t.Fatal("client still registered after disconnect")
+	}
+}
+
+func TestDuplicateClientIDReplacesOldConnection(t *testing.T) {
+	disconnected := make(chan struct{}, 2)
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), &WsCallback{
+		OnDisconnect: func(clientID string, err error) { disconnected <- struct{}{} },
+	}, discardLogger())
+	t.Cleanup(s.Shutdown)
+
+	first, second := wstest.NewFakeConn(), wstest.NewFakeConn()
+	s.reserveConnection()
+	s.serveConn("a", first, nil)
+	s.reserveConnection()
+	s.serveConn("a", second, nil)
+
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("replaced connection not torn down")
+	}
+	if !first.Closed() {
+		t.Fatal("replaced connection left open")
+	}
+	var closeFrame []byte
+	for _, w := range first.Writes() {
+		if w.Type == websocket.CloseMessage {
+			closeFrame = w.Data
+		}
+	}
+	if want := websocket.FormatCloseMessage(websocket.ClosePolicyViolation, "replaced by a newer connection"); string(closeFrame) != string(want) {
+		t.Fatalf("replaced connection got close frame %q, want %q", closeFrame, want)
+	}
+
+	if _, ok := s.ClientInfo("a"); !ok {
+		t.Fatal("tearing down the old connection removed the new one")
+	}
+	if n := s.metrics.currentConnections.Load(); n != 1 {
+		t.Fatalf("currentConnections = %d with one live client, want 1", n)
+	}
+	if err := s.Send("a", "hello"); err != nil {
+		t.Fatalf("Send to the new connection: %v", err)
+	}
+
+	second.Close()
+	select {
+	case <-disconnected:
+	case <-time.After(2 * time.Second):
+		t.Fatal("new connection not torn down")
+	}
+	if n := s.metrics.currentConnections.Load(); n != 0 {
+		t.Fatalf("currentConnections = %d after both closed, want 0", n)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"errors"
+	"time"
+)
+
+var ErrMessageExpired = errors.New("message deadline exceeded")
+
+// DeadlineMessage wraps a payload that must be written before Deadline, or
+// within TTL of being handed to Send/Broadcast. Expired messages are dropped
+// and reported through OnUndeliverable instead of being written late.
+type DeadlineMessage struct {
+	Payload  interface{}
+	Deadline time.Time
+	TTL      time.Duration
+}
+
+func unwrapDeadline(msg interface{}) (interface{}, time.Time) {
+	var dm DeadlineMessage
+	switch m := msg.(type) {
+	case DeadlineMessage:
+		dm = m
+	case *DeadlineMessage:
+		if m == nil {
+			return msg, time.Time{}
+		}
+		dm = *m
+	default:
+		return msg, time.Time{}
+	}
+
+	deadline := dm.Deadline
+	if dm.TTL > 0 {
+		if expiry := time.Now().Add(dm.TTL); deadline.IsZero() || expiry.Before(deadline) {
+			deadline = expiry
+		}
+	}
+	return dm.Payload, deadline
+}
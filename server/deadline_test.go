@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"websocket/wstest"
+)
+
+func TestExpiredMessageIsUndeliverable(t *testing.T) {
+	type event struct {
+		clientID string
+		msg      interface{}
+	}
+	undeliverable := make(chan event, 1)
+	s, url := newTestServer(t, nil, &WsCallback{
+		OnUndeliverable: func(clientID string, msg interface{}) {
+			undeliverable <- event{clientID, msg}
+		},
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	err := s.Send("a", DeadlineMessage{Payload: "late", Deadline: time.Now().Add(-time.Second)})
+	if !errors.Is(err, ErrMessageExpired) {
+		t.Fatalf("Send expired message = %v, want ErrMessageExpired", err)
+	}
+	select {
+	case ev := <-undeliverable:
+		if ev.clientID != "a" || ev.msg != "late" {
+			t.Fatalf("OnUndeliverable(%q, %#v), want (a, \"late\")", ev.clientID, ev.msg)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("OnUndeliverable not called for expired message")
+	}
+
+	if err := s.Send("a", DeadlineMessage{Payload: "on time", TTL: time.Minute}); err != nil {
+		t.Fatalf("Send after expiry: %v", err)
+	}
+	var got string
+	readJSON(t, conn, &got)
+	if got != "on time" {
+		t.Fatalf("client read %q, want %q", got, "on time")
+	}
+}
+
+// deadlineConn records every write deadline the server sets.
+type deadlineConn struct {
+	*wstest.FakeConn
+	deadlines []time.Time
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.deadlines = append(c.deadlines, t)
+	return c.FakeConn.SetWriteDeadline(t)
+}
+
+func TestMessageDeadlineKeepsWriteTimeout(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	conn := &deadlineConn{FakeConn: wstest.NewFakeConn()}
+	client := &Client{ClientID: "a", wsConn: conn}
+
+	item := &outbound{
+		messageType: websocket.TextMessage,
+		data:        []byte(`"soon"`),
+		deadline:    time.Now().Add(10 * time.Millisecond),
+	}
+	if err := s.writeTo(client, item); err != nil {
+		t.Fatalf("writeTo: %v", err)
+	}
+
+	if len(conn.deadlines) == 0 {
+		t.Fatal("writeTo set no write deadline")
+	}
+	if got := time.Until(conn.deadlines[0]); got < s.config.WriteTimeout-time.Second {
+		t.Fatalf("write deadline %v away, want about WriteTimeout %v", got, s.config.WriteTimeout)
+	}
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type HealthStatus struct {
+	ClientCount int64   `json:"client_count"`
+	Uptime      float64 `json:"uptime_seconds"`
+	Draining    bool    `json:"draining"`
+}
+
+// HealthHandler reports client count, uptime and drain state. It always
+// answers 200 so probes keep working while draining; load balancers should
+// stop routing new traffic when draining is true.
+func (s *Server) HealthHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := HealthStatus{
+			ClientCount: s.metrics.currentConnections.Load(),
+			Uptime:      time.Since(s.startedAt).Seconds(),
+			Draining:    s.draining.Load(),
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(status); err != nil {
+			s.logger.Errorf("Health response failed: %v", err)
+		}
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+type idempotencyCache struct {
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastSweep time.Time
+}
+
+func (s *Server) isDuplicate(clientID string, msg []byte) bool {
+	field := s.config.IdempotencyKeyField
+	if field == "" {
+		return false
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		return false
+	}
+	var key string
+	if err := json.Unmarshal(fields[field], &key); err != nil || key == "" {
+		return false
+	}
+
+	window := s.config.IdempotencyWindow
+	if window <= 0 {
+		window = 5 * time.Minute
+	}
+
+	cache := &s.idempotency
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	now := time.Now()
+	if cache.seen == nil {
+		cache.seen = make(map[string]time.Time)
+	}
+	if now.Sub(cache.lastSweep) > window {
+		for k, at := range cache.seen {
+			if now.Sub(at) > window {
+				delete(cache.seen, k)
+			}
+		}
+		cache.lastSweep = now
+	}
+
+	k := clientID + "\x00" + key
+	if at, ok := cache.seen[k]; ok && now.Sub(at) <= window {
+		return true
+	}
+	cache.seen[k] = now
+	return false
+}
@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestIsDuplicateByIdempotencyKey(t *testing.T) {
+	cfg := NewWsConfig("", "/ws", []string{"*"})
+	cfg.IdempotencyKeyField = "key"
+	s := NewServer(cfg, nil, discardLogger())
+
+	msg := []byte(`{"key":"order-1","payload":{"qty":2}}`)
+	if s.isDuplicate("a", msg) {
+		t.Fatal("first message reported as duplicate")
+	}
+	if !s.isDuplicate("a", msg) {
+		t.Fatal("retry with the same key not reported as duplicate")
+	}
+	if s.isDuplicate("b", msg) {
+		t.Fatal("keys are shared across clients")
+	}
+	if s.isDuplicate("a", []byte(`{"payload":1}`)) || s.isDuplicate("a", []byte(`{"payload":1}`)) {
+		t.Fatal("message without a key reported as duplicate")
+	}
+}
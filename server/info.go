@@ -0,0 +1,101 @@
+package main
+
+import (
+	"maps"
+	"time"
+)
+
+type ClientInfo struct {
+	ClientID    string
+	RemoteAddr  string
+	Origin      string
+	Subprotocol string
+	CertSubject string
+	ConnectedAt time.Time
+	LastReadAt  time.Time
+	LastWriteAt time.Time
+	Metadata    map[string]any
+}
+
+func (s *Server) ClientInfo(clientID string) (ClientInfo, bool) {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return ClientInfo{}, false
+	}
+	return client.info(), true
+}
+
+func (c *Client) info() ClientInfo {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	return ClientInfo{
+		ClientID:    c.ClientID,
+		RemoteAddr:  c.remoteAddr,
+		Origin:      c.origin,
+		Subprotocol: c.wsConn.Subprotocol(),
+		CertSubject: c.certSubject,
+		ConnectedAt: c.connectedAt,
+		LastReadAt:  unixNano(c.lastMessageAt.Load()),
+		LastWriteAt: unixNano(c.lastWriteAt.Load()),
+		Metadata:    maps.Clone(c.data),
+	}
+}
+
+func unixNano(ns int64) time.Time {
+	if ns == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, ns)
+}
+
+// StaleClients returns the IDs of clients that have not sent anything for
+// longer than olderThan.
+func (s *Server) StaleClients(olderThan time.Duration) []string {
+	var stale []string
+	s.clients.Range(func(_, value any) bool {
+		client, ok := value.(*Client)
+		if ok && client != nil && time.Since(time.Unix(0, client.lastMessageAt.Load())) > olderThan {
+			stale = append(stale, client.ClientID)
+		}
+		return true
+	})
+	return stale
+}
+
+func (s *Server) SetClientData(clientID string, key string, value any) error {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	client.stateMu.Lock()
+	defer client.stateMu.Unlock()
+	if client.data == nil {
+		client.data = make(map[string]any)
+	}
+	client.data[key] = value
+	return nil
+}
+
+func (s *Server) GetClientData(clientID, key string) (any, bool) {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return nil, false
+	}
+
+	client.stateMu.RLock()
+	defer client.stateMu.RUnlock()
+	value, ok := client.data[key]
+	return value, ok
+}
+
+func (s *Server) DeleteClientData(clientID, key string) {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return
+	}
+
+	client.stateMu.Lock()
+	defer client.stateMu.Unlock()
+	delete(client.data, key)
+}
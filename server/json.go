@@ -0,0 +1,46 @@
+package main
+
+import "encoding/json"
+
+func (s *Server) HandleJSON(msgType string, handler func(clientID string, raw json.RawMessage)) {
+	s.jsonMu.Lock()
+	defer s.jsonMu.Unlock()
+
+	if s.jsonHandlers == nil {
+		s.jsonHandlers = make(map[string]func(clientID string, raw json.RawMessage))
+	}
+	s.jsonHandlers[msgType] = handler
+}
+
+func (s *Server) dispatchJSON(clientID string, msg []byte) bool {
+	s.jsonMu.RLock()
+	empty := len(s.jsonHandlers) == 0
+	s.jsonMu.RUnlock()
+	if empty {
+		return false
+	}
+
+	field := s.config.JSONTypeField
+	if field == "" {
+		field = "type"
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(msg, &fields); err != nil {
+		return false
+	}
+
+	var msgType string
+	if err := json.Unmarshal(fields[field], &msgType); err != nil {
+		return false
+	}
+
+	s.jsonMu.RLock()
+	handler, ok := s.jsonHandlers[msgType]
+	s.jsonMu.RUnlock()
+	if !ok {
+		return false
+	}
+	handler(clientID, json.RawMessage(msg))
+	return true
+}
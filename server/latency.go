@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"maps"
+	"sync"
+	"time"
+)
+
+type pingRound struct {
+	sentAt  time.Time
+	mu      sync.Mutex
+	results map[string]time.Duration
+	updated chan struct{}
+}
+
+type pingEcho struct {
+	PingID string `json:"ping_id"`
+}
+
+// BroadcastPing sends {"ping_id": "..."} to every client and waits for each
+// to echo it back, returning per-client round-trip times. Clients that do not
+// echo before ctx expires are omitted.
+func (s *Server) BroadcastPing(ctx context.Context) map[string]time.Duration {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return nil
+	}
+	id := hex.EncodeToString(b)
+
+	round := &pingRound{
+		sentAt:  time.Now(),
+		results: make(map[string]time.Duration),
+		updated: make(chan struct{}, 1),
+	}
+	s.pingRounds.Store(id, round)
+	s.activePings.Add(1)
+	defer func() {
+		s.pingRounds.Delete(id)
+		s.activePings.Add(-1)
+	}()
+
+	// The probe bypasses BroadcastTransform so clients see, and echo, the
+	// ping_id this round is waiting for.
+	sent := s.broadcastMessage(pingEcho{PingID: id}, nil, false).Enqueued
+
+	for {
+		round.mu.Lock()
+		done := len(round.results) >= sent
+		round.mu.Unlock()
+		if done {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			round.mu.Lock()
+			defer round.mu.Unlock()
+			return maps.Clone(round.results)
+		case <-round.updated:
+		}
+	}
+
+	round.mu.Lock()
+	defer round.mu.Unlock()
+	return maps.Clone(round.results)
+}
+
+func (s *Server) recordPingEcho(clientID string, msg []byte) bool {
+	if s.activePings.Load() == 0 {
+		return false
+	}
+
+	var echo pingEcho
+	if err := json.Unmarshal(msg, &echo); err != nil || echo.PingID == "" {
+		return false
+	}
+
+	value, ok := s.pingRounds.Load(echo.PingID)
+	if !ok {
+		return false
+	}
+	round := value.(*pingRound)
+
+	round.mu.Lock()
+	if _, seen := round.results[clientID]; !seen {
+		round.results[clientID] = time.Since(round.sentAt)
+	}
+	round.mu.Unlock()
+
+	select {
+	case round.updated <- struct{}{}:
+	default:
+	}
+	return true
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestBroadcastPingCollectsEchoes(t *testing.T) {
+	s, url := newTestServer(t, nil, &WsCallback{
+		OnMessage: func(clientID string, msg []byte) { t.Errorf("ping echo from %s reached OnMessage: %s", clientID, msg) },
+	})
+	echo := dialTestClient(t, url, "echo")
+	silent := dialTestClient(t, url, "silent")
+	waitForClients(t, s, "echo", "silent")
+
+	go func() {
+		for {
+			_, msg, err := echo.ReadMessage()
+			if err != nil {
+				return
+			}
+			echo.WriteMessage(websocket.TextMessage, msg)
+		}
+	}()
+	go func() {
+		for {
+			if _, _, err := silent.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	rtts := s.BroadcastPing(ctx)
+
+	if time.Since(start) < 300*time.Millisecond {
+		t.Fatal("BroadcastPing returned before the silent client's deadline")
+	}
+	if len(rtts) != 1 {
+		t.Fatalf("BroadcastPing = %v, want only the echoing client", rtts)
+	}
+	if rtt, ok := rtts["echo"]; !ok || rtt <= 0 || rtt > 300*time.Millisecond {
+		t.Fatalf("echo rtt = %v (present %v)", rtt, ok)
+	}
+}
+
+func TestBroadcastPingReturnsOnceAllEcho(t *testing.T) {
+	s, url := newTestServer(t, nil, nil)
+	conn := dialTestClient(t, url, "echo")
+	waitForClients(t, s, "echo")
+	go func() {
+		_, msg, err := conn.ReadMessage()
+		if err == nil {
+			conn.WriteMessage(websocket.TextMessage, msg)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if rtts := s.BroadcastPing(ctx); len(rtts) != 1 {
+		t.Fatalf("BroadcastPing = %v", rtts)
+	}
+	if ctx.Err() != nil {
+		t.Fatal("BroadcastPing waited for the context although every client echoed")
+	}
+}
+
+func TestBroadcastPingBypassesTransform(t *testing.T) {
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.BroadcastTransform = func(msg interface{}) (interface{}, error) {
+			return map[string]interface{}{"wrapped": msg}, nil
+		}
+	}, nil)
+	conn := dialTestClient(t, url, "echo")
+	waitForClients(t, s, "echo")
+	go func() {
+		_, msg, err := conn.ReadMessage()
+		if err == nil {
+			conn.WriteMessage(websocket.TextMessage, msg)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if rtts := s.BroadcastPing(ctx); len(rtts) != 1 {
+		t.Fatalf("BroadcastPing = %v, want the echo despite BroadcastTransform", rtts)
+	}
+}
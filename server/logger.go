@@ -0,0 +1,37 @@
+package main
+
+import (
+	"fmt"
+	"log"
+)
+
+type Logger interface {
+	Debugf(format string, args ...any)
+	Infof(format string, args ...any)
+	Warnf(format string, args ...any)
+	Errorf(format string, args ...any)
+}
+
+type stdLogger struct {
+	l *log.Logger
+}
+
+func NewStdLogger(l *log.Logger) Logger {
+	return &stdLogger{l: l}
+}
+
+func (s *stdLogger) Debugf(format string, args ...any) {
+	s.l.Output(2, "DEBUG "+fmt.Sprintf(format, args...))
+}
+
+func (s *stdLogger) Infof(format string, args ...any) {
+	s.l.Output(2, "INFO "+fmt.Sprintf(format, args...))
+}
+
+func (s *stdLogger) Warnf(format string, args ...any) {
+	s.l.Output(2, "WARN "+fmt.Sprintf(format, args...))
+}
+
+func (s *stdLogger) Errorf(format string, args ...any) {
+	s.l.Output(2, "ERROR "+fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,63 @@
+package main
+
+import "sync/atomic"
+
+type ServerMetrics struct {
+	TotalConnections   int64
+	CurrentConnections int64
+	MessagesReceived   int64
+	MessagesPerClient  map[string]int64
+	BroadcastCount     int64
+	BytesIn            int64
+	BytesOut           int64
+
+	// UncompressedBytesSent counts payload bytes handed to the writer;
+	// CompressedBytesSent counts bytes written to the socket, including
+	// frame headers, control frames and the handshake response.
+	UncompressedBytesSent int64
+	CompressedBytesSent   int64
+}
+
+// CompressionRatio returns CompressedBytesSent / UncompressedBytesSent, or 0
+// before anything has been sent.
+func (m ServerMetrics) CompressionRatio() float64 {
+	if m.UncompressedBytesSent == 0 {
+		return 0
+	}
+	return float64(m.CompressedBytesSent) / float64(m.UncompressedBytesSent)
+}
+
+type serverMetrics struct {
+	totalConnections   atomic.Int64
+	currentConnections atomic.Int64
+	messagesReceived   atomic.Int64
+	broadcastCount     atomic.Int64
+	bytesIn            atomic.Int64
+	bytesOut           atomic.Int64
+	wireBytesOut       atomic.Int64
+}
+
+func (s *Server) Metrics() ServerMetrics {
+	perClient := make(map[string]int64)
+	s.clients.Range(func(key, value any) bool {
+		client, ok := value.(*Client)
+		if !ok || client == nil {
+			return true
+		}
+		perClient[client.ClientID] = client.messagesReceived.Load()
+		return true
+	})
+
+	return ServerMetrics{
+		TotalConnections:   s.metrics.totalConnections.Load(),
+		CurrentConnections: s.metrics.currentConnections.Load(),
+		MessagesReceived:   s.metrics.messagesReceived.Load(),
+		MessagesPerClient:  perClient,
+		BroadcastCount:     s.metrics.broadcastCount.Load(),
+		BytesIn:            s.metrics.bytesIn.Load(),
+		BytesOut:           s.metrics.bytesOut.Load(),
+
+		UncompressedBytesSent: s.metrics.bytesOut.Load(),
+		CompressedBytesSent:   s.metrics.wireBytesOut.Load(),
+	}
+}
@@ -0,0 +1,39 @@
+package main
+
+type MessageHandler func(clientID string, msg []byte)
+
+type Middleware func(next MessageHandler) MessageHandler
+
+// Use appends mw to the inbound chain. Middlewares run in registration order
+// before JSON routing and OnMessage; one that does not call next drops the
+// message, and one that calls next with a new slice transforms it.
+func (s *Server) Use(mw func(next MessageHandler) MessageHandler) {
+	s.middlewareMu.Lock()
+	defer s.middlewareMu.Unlock()
+	s.middleware = append(s.middleware, mw)
+}
+
+func (s *Server) applyMiddleware(final MessageHandler) MessageHandler {
+	s.middlewareMu.RLock()
+	defer s.middlewareMu.RUnlock()
+
+	handler := final
+	for i := len(s.middleware) - 1; i >= 0; i-- {
+		handler = s.middleware[i](handler)
+	}
+	return handler
+}
+
+func MaxSizeMiddleware(limit int, onReject func(clientID string, size int)) Middleware {
+	return func(next MessageHandler) MessageHandler {
+		return func(clientID string, msg []byte) {
+			if len(msg) > limit {
+				if onReject != nil {
+					onReject(clientID, len(msg))
+				}
+				return
+			}
+			next(clientID, msg)
+		}
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMiddlewareChain(t *testing.T) {
+	messages := make(chan string, 4)
+	s, url := newTestServer(t, nil, &WsCallback{
+		OnMessage: func(clientID string, msg []byte) { messages <- string(msg) },
+	})
+
+	var order []string
+	rejected := make(chan int, 1)
+	s.Use(func(next MessageHandler) MessageHandler {
+		return func(clientID string, msg []byte) {
+			order = append(order, "first")
+			next(clientID, msg)
+		}
+	})
+	s.Use(MaxSizeMiddleware(8, func(clientID string, size int) { rejected <- size }))
+	s.Use(func(next MessageHandler) MessageHandler {
+		return func(clientID string, msg []byte) {
+			order = append(order, "last")
+			next(clientID, bytes.ToUpper(msg))
+		}
+	})
+
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+	conn.WriteMessage(websocket.TextMessage, []byte("much too long"))
+	conn.WriteMessage(websocket.TextMessage, []byte("hi"))
+
+	select {
+	case size := <-rejected:
+		if size != len("much too long") {
+			t.Fatalf("rejected size %d", size)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("oversized message not rejected")
+	}
+	select {
+	case got := <-messages:
+		if got != "HI" {
+			t.Fatalf("OnMessage(%q), want the transformed HI", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not delivered through the chain")
+	}
+
+	// The rejected message stopped after the first middleware.
+	if want := []string{"first", "first", "last"}; !slices.Equal(order, want) {
+		t.Fatalf("middleware ran as %v, want %v", order, want)
+	}
+}
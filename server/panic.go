@@ -0,0 +1,46 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+var ErrHandlerPanic = errors.New("message handler panicked")
+
+type PanicPolicy int
+
+const (
+	PanicRecover PanicPolicy = iota
+	PanicDisconnect
+	PanicRepanic
+)
+
+// safeHandleMessage runs the message handlers, recovering a panic according
+// to PanicPolicy. It returns a non-nil error, wrapping ErrHandlerPanic, only
+// when the client should be disconnected.
+func (s *Server) safeHandleMessage(client *Client, msg []byte) (disconnectErr error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+
+		err := fmt.Errorf("%w for client %s: %v", ErrHandlerPanic, client.ClientID, r)
+		withStack := fmt.Errorf("%w\n%s", err, debug.Stack())
+		s.logger.Errorf("%v", withStack)
+		if s.callbacks.OnError != nil {
+			s.callbacks.OnError(withStack)
+		}
+
+		switch s.config.PanicPolicy {
+		case PanicRepanic:
+			panic(r)
+		case PanicDisconnect:
+			disconnectErr = err
+		}
+	}()
+
+	s.handleMessage(client, msg)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPanicDisconnectReportsPanic(t *testing.T) {
+	disconnected := make(chan error, 1)
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.PanicPolicy = PanicDisconnect
+	}, &WsCallback{
+		OnMessage:    func(clientID string, msg []byte) { panic("handler bug") },
+		OnDisconnect: func(clientID string, err error) { disconnected <- err },
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	conn.WriteMessage(websocket.TextMessage, []byte("boom"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseInternalServerErr) {
+		t.Fatalf("read after panic = %v, want close 1011", err)
+	}
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, ErrHandlerPanic) || !strings.Contains(err.Error(), "handler bug") {
+			t.Fatalf("OnDisconnect(%v), want ErrHandlerPanic with the panic value", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+}
+
+func TestPanicRecoverKeepsConnection(t *testing.T) {
+	messages := make(chan string, 2)
+	s, url := newTestServer(t, nil, &WsCallback{
+		OnMessage: func(clientID string, msg []byte) {
+			if string(msg) == "boom" {
+				panic("handler bug")
+			}
+			messages <- string(msg)
+		},
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	conn.WriteMessage(websocket.TextMessage, []byte("boom"))
+	conn.WriteMessage(websocket.TextMessage, []byte("after"))
+	select {
+	case got := <-messages:
+		if got != "after" {
+			t.Fatalf("OnMessage(%q)", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("connection did not survive a recovered panic")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import "time"
+
+// PauseClient stops reading from clientID so TCP backpressure throttles the
+// peer. Control frames are not read either, so a client paused for longer
+// than its own ping timeout will drop the connection.
+func (s *Server) PauseClient(clientID string) error {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	client.pauseMu.Lock()
+	defer client.pauseMu.Unlock()
+	if client.resume == nil {
+		client.resume = make(chan struct{})
+	}
+	return nil
+}
+
+func (s *Server) ResumeClient(clientID string) error {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	client.pauseMu.Lock()
+	defer client.pauseMu.Unlock()
+	if client.resume != nil {
+		close(client.resume)
+		client.resume = nil
+	}
+	return nil
+}
+
+func (s *Server) waitIfPaused(client *Client) bool {
+	client.pauseMu.Lock()
+	resume := client.resume
+	client.pauseMu.Unlock()
+
+	if resume == nil {
+		return true
+	}
+
+	select {
+	case <-client.ctx.Done():
+		return false
+	case <-resume:
+		client.wsConn.SetReadDeadline(time.Now().Add(s.config.PongWait))
+		return true
+	}
+}
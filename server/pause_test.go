@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestPauseClientStopsReading(t *testing.T) {
+	messages := make(chan string, 4)
+	s, url := newTestServer(t, nil, &WsCallback{
+		OnMessage: func(clientID string, msg []byte) { messages <- string(msg) },
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	conn.WriteMessage(websocket.TextMessage, []byte("primer"))
+	if got := <-messages; got != "primer" {
+		t.Fatalf("OnMessage(%q)", got)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if err := s.PauseClient("a"); err != nil {
+		t.Fatalf("PauseClient: %v", err)
+	}
+	// The read already blocked when the pause lands still completes.
+	conn.WriteMessage(websocket.TextMessage, []byte("in flight"))
+	select {
+	case got := <-messages:
+		if got != "in flight" {
+			t.Fatalf("OnMessage(%q)", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("in-flight read not completed")
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte("held"))
+	select {
+	case got := <-messages:
+		t.Fatalf("paused client's message %q was processed", got)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	if err := s.ResumeClient("a"); err != nil {
+		t.Fatalf("ResumeClient: %v", err)
+	}
+	select {
+	case got := <-messages:
+		if got != "held" {
+			t.Fatalf("OnMessage(%q), want held", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("message not processed after resume")
+	}
+
+	if err := s.PauseClient("missing"); err == nil {
+		t.Fatal("PauseClient on an unknown client succeeded")
+	}
+}
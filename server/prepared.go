@@ -0,0 +1,58 @@
+package main
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+type preparedKey struct {
+	messageType int
+	sum         [sha256.Size]byte
+}
+
+type preparedEntry struct {
+	msg     *websocket.PreparedMessage
+	expires time.Time
+}
+
+type preparedCache struct {
+	mu      sync.Mutex
+	entries map[preparedKey]preparedEntry
+}
+
+func (s *Server) prepare(messageType int, data []byte) (*websocket.PreparedMessage, error) {
+	ttl := s.config.PreparedMessageTTL
+	if ttl <= 0 {
+		return websocket.NewPreparedMessage(messageType, data)
+	}
+
+	key := preparedKey{messageType: messageType, sum: sha256.Sum256(data)}
+	now := time.Now()
+
+	cache := &s.preparedCache
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if entry, ok := cache.entries[key]; ok && now.Before(entry.expires) {
+		return entry.msg, nil
+	}
+
+	msg, err := websocket.NewPreparedMessage(messageType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	if cache.entries == nil {
+		cache.entries = make(map[preparedKey]preparedEntry)
+	}
+	for k, entry := range cache.entries {
+		if !now.Before(entry.expires) {
+			delete(cache.entries, k)
+		}
+	}
+	cache.entries[key] = preparedEntry{msg: msg, expires: now.Add(ttl)}
+	return msg, nil
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func newPrepareServer(ttl time.Duration) *Server {
+	cfg := NewWsConfig("", "/ws", []string{"*"})
+	cfg.PreparedMessageTTL = ttl
+	return NewServer(cfg, nil, discardLogger())
+}
+
+func TestPrepareReusesIdenticalPayloads(t *testing.T) {
+	s := newPrepareServer(time.Minute)
+
+	first, err := s.prepare(websocket.TextMessage, []byte(`{"status":"ok"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := s.prepare(websocket.TextMessage, []byte(`{"status":"ok"}`))
+	if again != first {
+		t.Fatal("identical payload was prepared again instead of reused")
+	}
+
+	changed, _ := s.prepare(websocket.TextMessage, []byte(`{"status":"degraded"}`))
+	if changed == first {
+		t.Fatal("changed payload reused the cached frame")
+	}
+	binary, _ := s.prepare(websocket.BinaryMessage, []byte(`{"status":"ok"}`))
+	if binary == first {
+		t.Fatal("binary frame reused the cached text frame")
+	}
+}
+
+func TestPrepareCacheExpires(t *testing.T) {
+	s := newPrepareServer(20 * time.Millisecond)
+
+	first, _ := s.prepare(websocket.TextMessage, []byte("tick"))
+	time.Sleep(30 * time.Millisecond)
+	if again, _ := s.prepare(websocket.TextMessage, []byte("tick")); again == first {
+		t.Fatal("frame reused after its TTL expired")
+	}
+}
+
+func TestPrepareCacheOffByDefault(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+
+	first, _ := s.prepare(websocket.TextMessage, []byte("tick"))
+	if again, _ := s.prepare(websocket.TextMessage, []byte("tick")); again == first {
+		t.Fatal("NewWsConfig enabled the prepared message cache")
+	}
+}
+
+func BenchmarkPrepare(b *testing.B) {
+	data := bytes.Repeat([]byte(`{"status":"ok","load":0.42},`), 150)
+
+	for _, bc := range []struct {
+		name string
+		ttl  time.Duration
+	}{
+		{"uncached", 0},
+		{"cached", time.Minute},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			s := newPrepareServer(bc.ttl)
+			b.ReportAllocs()
+			b.SetBytes(int64(len(data)))
+			for i := 0; i < b.N; i++ {
+				if _, err := s.prepare(websocket.TextMessage, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
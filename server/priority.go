@@ -0,0 +1,58 @@
+package main
+
+type Priority int
+
+const (
+	PriorityNormal Priority = iota
+	PriorityHigh
+	PriorityLow
+)
+
+// prioritySchedule is the order in which the writer favours each queue when
+// several are backed up: high gets four turns in seven, normal two and low
+// one, so lower priorities are slowed but never starved.
+var prioritySchedule = [...]Priority{
+	PriorityHigh, PriorityHigh, PriorityNormal, PriorityHigh,
+	PriorityHigh, PriorityNormal, PriorityLow,
+}
+
+func (s *Server) SendPriority(clientID string, msg interface{}, p Priority) error {
+	return <-s.sendAsync(clientID, msg, func(item *outbound) {
+		item.priority = p
+	})
+}
+
+func (c *Client) queue(p Priority) chan *outbound {
+	switch p {
+	case PriorityHigh:
+		return c.sendHigh
+	case PriorityLow:
+		return c.sendLow
+	default:
+		return c.send
+	}
+}
+
+// nextOutbound returns the next item for the writer, blocking until one is
+// queued. It returns false once the client's context is done.
+func (c *Client) nextOutbound(turn int) (*outbound, bool) {
+	first := prioritySchedule[turn%len(prioritySchedule)]
+	for _, p := range [...]Priority{first, PriorityHigh, PriorityNormal, PriorityLow} {
+		select {
+		case item := <-c.queue(p):
+			return item, true
+		default:
+		}
+	}
+
+	select {
+	case <-c.ctx.Done():
+		return nil, false
+	case item := <-c.sendHigh:
+		return item, true
+	case item := <-c.send:
+		return item, true
+	case item := <-c.sendLow:
+		return item, true
+	}
+}
@@ -0,0 +1,60 @@
+package main
+
+import "testing"
+
+func TestPriorityQueueSizes(t *testing.T) {
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.SendQueueSize = 16
+		cfg.PriorityQueueSize = 4
+	}, nil)
+	dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+	client, _ := s.getClient("a")
+
+	if got := cap(client.send); got != 16 {
+		t.Errorf("normal queue capacity = %d, want SendQueueSize", got)
+	}
+	if got := cap(client.sendHigh); got != 4 {
+		t.Errorf("high queue capacity = %d, want PriorityQueueSize", got)
+	}
+	if got := cap(client.sendLow); got != 4 {
+		t.Errorf("low queue capacity = %d, want PriorityQueueSize", got)
+	}
+}
+
+func TestNextOutboundFavoursHighPriority(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	client := addQueuedClient(s, "a", 8)
+
+	for _, p := range []Priority{PriorityLow, PriorityNormal, PriorityNormal, PriorityHigh, PriorityHigh, PriorityHigh, PriorityHigh} {
+		client.queue(p) <- &outbound{priority: p}
+	}
+
+	var got []Priority
+	for turn := 0; turn < len(prioritySchedule); turn++ {
+		item, ok := client.nextOutbound(turn)
+		if !ok {
+			t.Fatal("nextOutbound returned no item")
+		}
+		got = append(got, item.priority)
+	}
+
+	for i, want := range prioritySchedule {
+		if got[i] != want {
+			t.Fatalf("dequeue order = %v, want %v", got, prioritySchedule)
+		}
+	}
+}
+
+func TestBroadcastSyncUsesPriorityQueue(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	client := addQueuedClient(s, "a", 1)
+
+	if n := s.BroadcastSync("hello"); n != 1 {
+		t.Fatalf("BroadcastSync enqueued %d, want 1", n)
+	}
+	if len(client.send) != 1 || len(client.sendHigh) != 0 || len(client.sendLow) != 0 {
+		t.Fatalf("queue depths high=%d normal=%d low=%d, want the item on the normal queue",
+			len(client.sendHigh), len(client.send), len(client.sendLow))
+	}
+}
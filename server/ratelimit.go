@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrRateLimited = errors.New("client exceeded rate limit")
+
+type RateLimitPolicy int
+
+const (
+	RateLimitDrop RateLimitPolicy = iota
+	RateLimitDisconnect
+)
+
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate float64, burst int) *tokenBucket {
+	if burst < 1 {
+		burst = 1
+	}
+	return &tokenBucket{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+func (b *tokenBucket) allow(now time.Time) bool {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// allowMessage takes a token from the client's bucket. When none is left it
+// reports the overrun and returns an error wrapping ErrRateLimited; the read
+// loop then drops the message or disconnects per RateLimitPolicy.
+func (s *Server) allowMessage(client *Client) error {
+	if client.limiter == nil || client.limiter.allow(time.Now()) {
+		return nil
+	}
+
+	err := fmt.Errorf("%w: client %s over %.2f msg/s", ErrRateLimited, client.ClientID, s.config.MessagesPerSecond)
+	s.logger.Warnf("%v", err)
+	if s.callbacks.OnError != nil {
+		s.callbacks.OnError(err)
+	}
+	return err
+}
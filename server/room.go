@@ -0,0 +1,83 @@
+package main
+
+import "sync"
+
+func (s *Server) JoinRoom(clientID, room string) error {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	client.stateMu.Lock()
+	defer client.stateMu.Unlock()
+	if client.rooms == nil {
+		client.rooms = make(map[string]struct{})
+	}
+	client.rooms[room] = struct{}{}
+	return nil
+}
+
+func (s *Server) LeaveRoom(clientID, room string) error {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	client.stateMu.Lock()
+	defer client.stateMu.Unlock()
+	delete(client.rooms, room)
+	return nil
+}
+
+type SequencedMessage struct {
+	Seq     uint64      `json:"seq"`
+	Payload interface{} `json:"payload"`
+}
+
+type roomSequencer struct {
+	mu  sync.Mutex
+	seq uint64
+}
+
+func (s *Server) BroadcastToRoom(room string, msg interface{}) BroadcastResult {
+	inRoom := func(c *Client) bool {
+		return c.inRoom(room)
+	}
+	msg, ok := s.transformBroadcast(msg)
+	if !ok {
+		return BroadcastResult{}
+	}
+	if !s.config.OrderedRooms {
+		return s.broadcastMessage(msg, inRoom, false)
+	}
+
+	value, _ := s.roomSequencers.LoadOrStore(room, &roomSequencer{})
+	seq := value.(*roomSequencer)
+
+	seq.mu.Lock()
+	defer seq.mu.Unlock()
+	seq.seq++
+
+	payload, deadline := unwrapDeadline(msg)
+	return s.broadcastEncoded(SequencedMessage{Seq: seq.seq, Payload: payload}, payload, deadline, inRoom, false)
+}
+
+func (s *Server) RoomMembers(room string) []ClientInfo {
+	var members []ClientInfo
+	s.clients.Range(func(key, value any) bool {
+		client, ok := value.(*Client)
+		if !ok || client == nil || !client.inRoom(room) {
+			return true
+		}
+		members = append(members, client.info())
+		return true
+	})
+	return members
+}
+
+func (c *Client) inRoom(room string) bool {
+	c.stateMu.RLock()
+	defer c.stateMu.RUnlock()
+	_, ok := c.rooms[room]
+	return ok
+}
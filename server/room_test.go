@@ -0,0 +1,94 @@
+package main
+
+import (
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestOrderedRoomsSequenceBroadcasts(t *testing.T) {
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.OrderedRooms = true
+	}, nil)
+	a := dialTestClient(t, url, "a")
+	b := dialTestClient(t, url, "b")
+	dialTestClient(t, url, "outside")
+	waitForClients(t, s, "a", "b", "outside")
+	s.JoinRoom("a", "lobby")
+	s.JoinRoom("b", "lobby")
+
+	for _, text := range []string{"one", "two", "three"} {
+		if result := s.BroadcastToRoom("lobby", text); result.Enqueued != 2 {
+			t.Fatalf("BroadcastToRoom enqueued %d, want 2", result.Enqueued)
+		}
+	}
+
+	for _, conn := range []*websocket.Conn{a, b} {
+		for i, want := range []string{"one", "two", "three"} {
+			var got SequencedMessage
+			readJSON(t, conn, &got)
+			if got.Seq != uint64(i+1) || got.Payload != want {
+				t.Fatalf("got seq %d %v, want seq %d %q", got.Seq, got.Payload, i+1, want)
+			}
+		}
+	}
+}
+
+func TestOrderedRoomUndeliverableGetsCallerPayload(t *testing.T) {
+	undeliverable := make(chan interface{}, 1)
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.OrderedRooms = true
+	}, &WsCallback{
+		OnUndeliverable: func(clientID string, msg interface{}) { undeliverable <- msg },
+	})
+	dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+	s.JoinRoom("a", "lobby")
+
+	s.BroadcastToRoom("lobby", DeadlineMessage{Payload: "late", Deadline: time.Now().Add(-time.Second)})
+
+	select {
+	case msg := <-undeliverable:
+		if msg != "late" {
+			t.Fatalf("OnUndeliverable got %#v, want the caller's payload", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnUndeliverable not called")
+	}
+}
+
+func TestRoomMembers(t *testing.T) {
+	s, url := newTestServer(t, nil, nil)
+	for _, id := range []string{"a", "b", "outside"} {
+		dialTestClient(t, url, id)
+	}
+	waitForClients(t, s, "a", "b", "outside")
+	s.JoinRoom("a", "lobby")
+	s.JoinRoom("b", "lobby")
+	s.SetClientData("a", "role", "moderator")
+	s.SetClientData("b", "role", "guest")
+
+	members := s.RoomMembers("lobby")
+	sort.Slice(members, func(i, j int) bool { return members[i].ClientID < members[j].ClientID })
+	if len(members) != 2 || members[0].ClientID != "a" || members[1].ClientID != "b" {
+		t.Fatalf("RoomMembers(lobby) = %+v, want a and b", members)
+	}
+	for _, m := range members {
+		if m.ConnectedAt.IsZero() {
+			t.Errorf("member %s has no connect time", m.ClientID)
+		}
+	}
+	if members[0].Metadata["role"] != "moderator" || members[1].Metadata["role"] != "guest" {
+		t.Fatalf("metadata %v, %v", members[0].Metadata, members[1].Metadata)
+	}
+
+	members[0].Metadata["role"] = "changed"
+	if role, _ := s.GetClientData("a", "role"); role != "moderator" {
+		t.Fatalf("editing the roster changed the client's metadata to %v", role)
+	}
+	if got := s.RoomMembers("empty"); len(got) != 0 {
+		t.Fatalf("RoomMembers(empty) = %+v", got)
+	}
+}
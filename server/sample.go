@@ -0,0 +1,33 @@
+package main
+
+import (
+	"math/rand/v2"
+	"sync"
+)
+
+type sampler struct {
+	mu  sync.Mutex
+	rng *rand.Rand
+}
+
+func (s *Server) SeedSampling(seed uint64) {
+	s.sampler.mu.Lock()
+	defer s.sampler.mu.Unlock()
+	s.sampler.rng = rand.New(rand.NewPCG(seed, seed))
+}
+
+func (s *Server) BroadcastSample(fraction float64, msg interface{}) int {
+	result := s.broadcast(msg, func(c *Client) bool {
+		return s.sampler.pick(fraction)
+	})
+	return result.Enqueued
+}
+
+func (sm *sampler) pick(fraction float64) bool {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+	if sm.rng == nil {
+		sm.rng = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	}
+	return sm.rng.Float64() < fraction
+}
@@ -2,12 +2,20 @@ package main
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"slices"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -15,23 +23,125 @@ import (
 
 type Client struct {
 	ClientID string
-	wsConn   *websocket.Conn
-	mu       sync.Mutex
+	wsConn   wsConn
+	mu       sync.Mutex // held by writeTo around each data frame
+	send     chan *outbound
+	sendHigh chan *outbound
+	sendLow  chan *outbound
+
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	remoteAddr  string
+	origin      string
+	certSubject string
+	limiter     *tokenBucket
+
+	pauseMu sync.Mutex
+	resume  chan struct{}
+
+	stateMu sync.RWMutex
+	topics  map[string]struct{}
+	rooms   map[string]struct{}
+	data    map[string]any
+
+	// closeCause is set when the server closes the connection from outside
+	// the read loop, so the loop reports it instead of a client hangup.
+	closeCause error
+
+	connectedAt      time.Time
+	lastMessageAt    atomic.Int64
+	lastWriteAt      atomic.Int64
+	messagesReceived atomic.Int64
 }
 
 type WsConfig struct {
 	Addr           string
 	Path           string
+	HealthPath     string
 	AllowedOrigins []string
 
+	TrustProxyHeaders bool
+	TLSConfig         *tls.Config
+
+	// RequireClientCert enforces mTLS against ClientCAs and uses the
+	// verified certificate's CommonName as the client ID.
+	RequireClientCert bool
+	ClientCAs         *x509.CertPool
+
 	HandshakeTimeout time.Duration
 	PongWait         time.Duration
 	WriteTimeout     time.Duration
+	IdleTimeout      time.Duration
+
+	MaxConnections           int
+	MaxMessagesPerConnection int
+	MaxHandshakeHeaderBytes  int
+
+	// IDGenerator assigns an ID when the Client-Id header is absent. The
+	// assigned ID is returned in the Client-Id handshake response header.
+	IDGenerator func(r *http.Request) string
+
+	MessagesPerSecond float64
+	BurstSize         int
+	RateLimitPolicy   RateLimitPolicy
 
 	MaxReadMessageSize int
-	ReadBufferSize     int
-	WriteBufferSize    int
 	EnableCompression  bool
+
+	// ReadBufferSize is held by every connection for its lifetime, so it
+	// dominates idle memory; messages larger than it are read in several
+	// syscalls. WriteBufferSize buffers are borrowed from WriteBufferPool
+	// only while a message is being written, so large values cost little
+	// when most clients are idle but raise the peak during broadcasts.
+	// NewServer defaults WriteBufferPool to a sync.Pool shared by all
+	// connections.
+	ReadBufferSize  int
+	WriteBufferSize int
+	WriteBufferPool websocket.BufferPool
+
+	// SendQueueSize is the capacity of each client's normal priority queue.
+	// PriorityQueueSize sizes the high and low priority queues separately,
+	// so a client can hold up to SendQueueSize + 2*PriorityQueueSize
+	// messages. SlowClientPolicy applies to whichever queue is full.
+	SendQueueSize     int
+	PriorityQueueSize int
+	SlowClientPolicy  SlowClientPolicy
+
+	// PreparedMessageTTL > 0 caches the prepared frame for each broadcast
+	// payload for this long, keyed by a hash of the encoded bytes, so an
+	// identical broadcast reuses the frame and its per-client compression
+	// instead of building them again. The message is still JSON-encoded and
+	// hashed on every call. Zero disables the cache.
+	PreparedMessageTTL time.Duration
+	PanicPolicy        PanicPolicy
+
+	// OrderedRooms wraps BroadcastToRoom payloads in a SequencedMessage and
+	// serializes broadcasts per room, so every member sees the same order.
+	// Concurrent broadcasts to one room no longer run in parallel.
+	OrderedRooms bool
+
+	JSONTypeField string
+
+	IdempotencyKeyField string
+	IdempotencyWindow   time.Duration
+
+	ProtocolVersion string
+
+	MessageValidator func(clientID string, msg []byte) error
+	ValidationPolicy ValidationPolicy
+
+	BatchWindow  time.Duration
+	MaxBatchSize int
+
+	// BroadcastTransform rewrites each broadcast message once, before it is
+	// encoded for any client. An error aborts the broadcast and is reported
+	// to OnError. It applies to the broadcasts that JSON-encode a value:
+	// Broadcast, BroadcastOlderThan, BroadcastWhere, BroadcastTopic,
+	// BroadcastSample, BroadcastSync, BroadcastToRoom and BroadcastBatched.
+	// BroadcastBytes and BroadcastBinaryFunc send their frames as given, and
+	// BroadcastPing's probe is never transformed.
+	BroadcastTransform func(msg interface{}) (interface{}, error)
 }
 
 func NewWsConfig(addr, path string, allowedOrigins []string) *WsConfig {
@@ -47,6 +157,10 @@ func NewWsConfig(addr, path string, allowedOrigins []string) *WsConfig {
 		ReadBufferSize:     256 * 1024,
 		WriteBufferSize:    256 * 1024,
 		EnableCompression:  false,
+		SendQueueSize:      256,
+		PriorityQueueSize:  32,
+		SlowClientPolicy:   DisconnectSlow,
+		JSONTypeField:      "type",
 	}
 }
 
@@ -57,6 +171,13 @@ type WsCallback struct {
 	OnDisconnect func(clientID string, err error)
 	OnMessage    func(clientID string, msg []byte)
 	OnError      func(err error)
+
+	OnConnectInfo   func(info ClientInfo)
+	OnMessageCtx    func(ctx context.Context, clientID string, msg []byte)
+	OnMessageTiming func(clientID string, dur time.Duration)
+	OnUndeliverable func(clientID string, msg interface{})
+	OnSendError     func(clientID string, msg interface{}, err error)
+	OnUpgradeError  func(r *http.Request, err error)
 }
 
 type Server struct {
@@ -64,29 +185,59 @@ type Server struct {
 	upgrader   websocket.Upgrader
 	clients    sync.Map
 	callbacks  *WsCallback
-	logger     *log.Logger
+	logger     Logger
 	httpServer *http.Server
 	ctx        context.Context
 	cancel     context.CancelFunc
+	metrics    serverMetrics
+	draining   atomic.Bool
+	startedAt  time.Time
+
+	maxConnections atomic.Int64
+
+	pingRounds     sync.Map
+	roomSequencers sync.Map
+	activePings    atomic.Int64
+
+	idempotency   idempotencyCache
+	preparedCache preparedCache
+	sampler       sampler
+	batch         broadcastBatch
+
+	auditMu   sync.Mutex
+	auditLog  io.Writer
+	auditHash string
+
+	middlewareMu sync.RWMutex
+	middleware   []Middleware
+
+	jsonMu       sync.RWMutex
+	jsonHandlers map[string]func(clientID string, raw json.RawMessage)
 
 	startOnce sync.Once
 	stopOnce  sync.Once
 }
 
-func NewServer(config *WsConfig, callback *WsCallback, logger *log.Logger) *Server {
+func NewServer(config *WsConfig, callback *WsCallback, logger Logger) *Server {
 	if callback == nil {
 		callback = &WsCallback{}
 	}
 	if logger == nil {
-		logger = log.New(os.Stdout, "[ws-server] ", log.LstdFlags|log.Llongfile)
+		logger = NewStdLogger(log.New(os.Stdout, "[ws-server] ", log.LstdFlags|log.Llongfile))
 	}
 	ctx, cancel := context.WithCancel(context.Background())
-	return &Server{
+	writeBufferPool := config.WriteBufferPool
+	if writeBufferPool == nil {
+		writeBufferPool = &sync.Pool{}
+	}
+
+	s := &Server{
 		config:    config,
 		logger:    logger,
 		callbacks: callback,
 		ctx:       ctx,
 		cancel:    cancel,
+		startedAt: time.Now(),
 		upgrader: websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				origin := r.Header.Get("Origin")
@@ -98,15 +249,22 @@ func NewServer(config *WsConfig, callback *WsCallback, logger *log.Logger) *Serv
 			HandshakeTimeout:  config.HandshakeTimeout,
 			ReadBufferSize:    config.ReadBufferSize,
 			WriteBufferSize:   config.WriteBufferSize,
+			WriteBufferPool:   writeBufferPool,
 			EnableCompression: config.EnableCompression,
 		},
 	}
+	s.maxConnections.Store(int64(config.MaxConnections))
+	return s
 }
 
 func (s *Server) OnMessage(handler func(clientID string, msg []byte)) {
 	s.callbacks.OnMessage = handler
 }
 
+func (s *Server) OnMessageCtx(handler func(ctx context.Context, clientID string, msg []byte)) {
+	s.callbacks.OnMessageCtx = handler
+}
+
 func (s *Server) OnStarted(handler func()) {
 	s.callbacks.Started = handler
 }
@@ -119,6 +277,10 @@ func (s *Server) OnConnect(handler func(clientID string)) {
 	s.callbacks.OnConnect = handler
 }
 
+func (s *Server) OnConnectInfo(handler func(info ClientInfo)) {
+	s.callbacks.OnConnectInfo = handler
+}
+
 func (s *Server) OnDisconnect(handler func(clientID string, err error)) {
 	s.callbacks.OnDisconnect = handler
 }
@@ -127,27 +289,107 @@ func (s *Server) OnError(handler func(err error)) {
 	s.callbacks.OnError = handler
 }
 
+func (s *Server) OnMessageTiming(handler func(clientID string, dur time.Duration)) {
+	s.callbacks.OnMessageTiming = handler
+}
+
+func (s *Server) OnUndeliverable(handler func(clientID string, msg interface{})) {
+	s.callbacks.OnUndeliverable = handler
+}
+
+func (s *Server) OnSendError(handler func(clientID string, msg interface{}, err error)) {
+	s.callbacks.OnSendError = handler
+}
+
+func (s *Server) OnUpgradeError(handler func(r *http.Request, err error)) {
+	s.callbacks.OnUpgradeError = handler
+}
+
+func (s *Server) SetMaxConnections(n int) {
+	s.maxConnections.Store(int64(n))
+}
+
+// Drain rejects new upgrades with 503 while existing clients keep working.
+func (s *Server) Drain() {
+	s.draining.Store(true)
+}
+
+func (s *Server) Undrain() {
+	s.draining.Store(false)
+}
+
+func (s *Server) IsDraining() bool {
+	return s.draining.Load()
+}
+
+// Handler returns the WebSocket upgrade handler for mounting on an existing
+// mux or router. Connection and message callbacks fire exactly as they do
+// under Start; Started is only invoked by Start, and Shutdown still closes
+// every client accepted through the handler.
+func (s *Server) Handler() http.Handler {
+	return http.HandlerFunc(s.handleWS)
+}
+
 func (s *Server) Start() error {
+	return s.serve("ws://localhost"+s.config.Addr, func(srv *http.Server) error {
+		return srv.ListenAndServe()
+	})
+}
+
+// StartTLS serves over TLS using certFile/keyFile, or the certificates in
+// WsConfig.TLSConfig when both paths are empty. It fails with
+// ErrClientCAsRequired when RequireClientCert is set without a CA pool.
+func (s *Server) StartTLS(certFile, keyFile string) error {
+	if err := s.checkTLSConfig(); err != nil {
+		return err
+	}
+	return s.serve("wss://localhost"+s.config.Addr, func(srv *http.Server) error {
+		return srv.ListenAndServeTLS(certFile, keyFile)
+	})
+}
+
+// StartUnix serves on a Unix domain socket at socketPath, replacing any stale
+// socket file. The file is removed again when the server stops.
+func (s *Server) StartUnix(socketPath string) error {
+	return s.serve("ws+unix://"+socketPath+":", func(srv *http.Server) error {
+		if err := os.Remove(socketPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		listener, err := net.Listen("unix", socketPath)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(socketPath)
+		return srv.Serve(listener)
+	})
+}
+
+func (s *Server) serve(base string, listen func(srv *http.Server) error) error {
 	var startErr error
 
 	s.startOnce.Do(func() {
 		mux := http.NewServeMux()
-		mux.HandleFunc(s.config.Path, s.handleWS)
+		mux.Handle(s.config.Path, s.Handler())
+		if s.config.HealthPath != "" {
+			mux.Handle(s.config.HealthPath, s.HealthHandler())
+		}
 
 		s.httpServer = &http.Server{
-			Addr:    s.config.Addr,
-			Handler: mux,
+			Addr:              s.config.Addr,
+			Handler:           mux,
+			TLSConfig:         s.tlsConfig(),
+			ReadHeaderTimeout: s.config.HandshakeTimeout,
 		}
 
-		s.logger.Printf("WebSocket server running at ws://localhost%s%s", s.config.Addr, s.config.Path)
+		s.logger.Infof("WebSocket server running at %s%s", base, s.config.Path)
 
 		if s.callbacks.Started != nil {
 			s.callbacks.Started()
 		}
 
-		startErr = s.httpServer.ListenAndServe()
+		startErr = listen(s.httpServer)
 		if startErr != nil {
-			s.logger.Printf("HTTP server failed: %v", startErr)
+			s.logger.Errorf("HTTP server failed: %v", startErr)
 		}
 	})
 
@@ -156,51 +398,178 @@ func (s *Server) Start() error {
 
 func (s *Server) handleWS(w http.ResponseWriter, r *http.Request) {
 
+	if s.draining.Load() {
+		s.rejectUpgrade(w, r, http.StatusServiceUnavailable, ErrServerDraining)
+		return
+	}
+
+	if err := s.reserveConnection(); err != nil {
+		s.logger.Warnf("%v", err)
+		if s.callbacks.OnError != nil {
+			s.callbacks.OnError(err)
+		}
+		s.rejectUpgrade(w, r, http.StatusServiceUnavailable, err)
+		return
+	}
+	served := false
+	defer func() {
+		if !served {
+			s.metrics.currentConnections.Add(-1)
+		}
+	}()
+
+	if limit := s.config.MaxHandshakeHeaderBytes; limit > 0 && headerSize(r.Header) > limit {
+		s.rejectUpgrade(w, r, http.StatusRequestHeaderFieldsTooLarge, ErrHeadersTooLarge)
+		return
+	}
+
 	clientID := r.Header.Get("Client-Id")
 
+	if s.config.RequireClientCert {
+		cert := verifiedPeerCert(r)
+		if cert == nil {
+			s.audit("auth_failed", clientID, s.remoteAddr(r), "client certificate required")
+			s.rejectUpgrade(w, r, http.StatusUnauthorized, ErrClientCertRequired)
+			return
+		}
+		clientID = cert.Subject.CommonName
+		s.audit("auth", clientID, s.remoteAddr(r), cert.Subject.String())
+	}
+
+	responseHeader := http.Header{}
+	responseHeader.Set(frameCapabilityHeader, "text, binary")
+	if s.config.ProtocolVersion != "" {
+		responseHeader.Set(protocolVersionHeader, s.config.ProtocolVersion)
+	}
+
+	if clientID == "" && s.config.IDGenerator != nil {
+		clientID = s.generateClientID(r)
+		if clientID == "" {
+			s.rejectUpgrade(w, r, http.StatusInternalServerError, ErrClientIDUnavailable)
+			return
+		}
+		responseHeader.Set("Client-Id", clientID)
+	}
+
 	if clientID == "" {
-		http.Error(w, "missing client ID", http.StatusBadRequest)
+		s.rejectUpgrade(w, r, http.StatusBadRequest, ErrMissingClientID)
 		return
 	}
 
-	conn, err := s.upgrader.Upgrade(w, r, nil)
+	conn, err := s.upgrader.Upgrade(&countingResponseWriter{ResponseWriter: w, written: &s.metrics.wireBytesOut}, r, responseHeader)
 	if err != nil {
-		s.logger.Println("WebSocket upgrade failed:", err)
+		s.logger.Errorf("WebSocket upgrade failed: %v", err)
 		if s.callbacks.OnError != nil {
 			s.callbacks.OnError(err)
 		}
+		s.upgradeError(r, err)
 		http.Error(w, "WebSocket upgrade failed", http.StatusBadRequest)
 		return
 	}
 
-	s.clients.Store(clientID, &Client{
-		ClientID: clientID,
-		wsConn:   conn,
-		mu:       sync.Mutex{},
+	served = true
+	s.serveConn(clientID, conn, func(client *Client) {
+		client.remoteAddr = s.remoteAddr(r)
+		client.origin = r.Header.Get("Origin")
+		client.certSubject = verifiedCertSubject(r)
 	})
+}
+
+// serveConn registers an upgraded connection as clientID and starts its
+// reader and writer. setup, if non-nil, fills in request details before
+// OnConnect fires. The caller must already hold a slot from
+// reserveConnection. Tests call it directly with a wstest.FakeConn.
+func (s *Server) serveConn(clientID string, conn wsConn, setup func(client *Client)) {
+	ctx, cancel := context.WithCancel(s.ctx)
+	client := &Client{
+		ClientID:    clientID,
+		wsConn:      conn,
+		mu:          sync.Mutex{},
+		send:        make(chan *outbound, max(s.config.SendQueueSize, 1)),
+		sendHigh:    make(chan *outbound, max(s.config.PriorityQueueSize, 1)),
+		sendLow:     make(chan *outbound, max(s.config.PriorityQueueSize, 1)),
+		ctx:         ctx,
+		cancel:      cancel,
+		connectedAt: time.Now(),
+	}
+	if setup != nil {
+		setup(client)
+	}
+	client.lastMessageAt.Store(client.connectedAt.UnixNano())
+	if s.config.MessagesPerSecond > 0 {
+		client.limiter = newTokenBucket(s.config.MessagesPerSecond, s.config.BurstSize)
+	}
+	s.metrics.totalConnections.Add(1)
+	if previous, loaded := s.clients.Swap(clientID, client); loaded {
+		s.evict(previous.(*Client))
+	}
+	s.audit("connect", clientID, client.remoteAddr, "")
 
 	if s.callbacks.OnConnect != nil {
 		s.callbacks.OnConnect(clientID)
 	}
+	if s.callbacks.OnConnectInfo != nil {
+		s.callbacks.OnConnectInfo(client.info())
+	}
 
-	go s.listen(clientID, conn)
+	go s.writePump(client)
+	go s.listen(client)
+
+	if s.config.IdleTimeout > 0 {
+		go s.watchIdle(client)
+	}
 }
 
-func (s *Server) listen(clientID string, conn *websocket.Conn) {
-	value, ok := s.clients.Load(clientID)
-	if !ok {
-		return
+func (s *Server) generateClientID(r *http.Request) string {
+	for attempt := 0; attempt < 10; attempt++ {
+		id := s.config.IDGenerator(r)
+		if id == "" {
+			continue
+		}
+		if _, exists := s.clients.Load(id); !exists {
+			return id
+		}
 	}
+	return ""
+}
 
-	client, ok := value.(*Client)
-	if !ok || client == nil {
-		return
+func headerSize(header http.Header) int {
+	size := 0
+	for key, values := range header {
+		for _, value := range values {
+			size += len(key) + len(value) + len(": \r\n")
+		}
 	}
+	return size
+}
+
+func (s *Server) remoteAddr(r *http.Request) string {
+	if s.config.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+	}
+	return r.RemoteAddr
+}
+
+func (s *Server) listen(client *Client) {
+	clientID, conn := client.ClientID, client.wsConn
+
+	disconnectErr := fmt.Errorf("client terminated connection")
+	closeCode, closeReason := websocket.CloseNormalClosure, "client disconnected"
+	closeSent := false
 
 	defer func() {
-		s.closeConnection(clientID, conn, "client disconnected")
+		client.cancel()
+		if closeSent {
+			s.releaseConnection(clientID, conn)
+		} else {
+			s.closeConnectionWithCode(clientID, conn, closeCode, closeReason)
+		}
+		s.audit("disconnect", clientID, client.remoteAddr, disconnectErr.Error())
 		if s.callbacks.OnDisconnect != nil {
-			s.callbacks.OnDisconnect(clientID, fmt.Errorf("client terminated connection"))
+			s.callbacks.OnDisconnect(clientID, disconnectErr)
 		}
 	}()
 
@@ -208,36 +577,209 @@ func (s *Server) listen(clientID string, conn *websocket.Conn) {
 	conn.SetReadDeadline(time.Now().Add(s.config.PongWait))
 
 	conn.SetPingHandler(func(appData string) error {
-		conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
-		err := conn.WriteMessage(websocket.PongMessage, []byte(appData))
+		err := conn.WriteControl(websocket.PongMessage, []byte(appData), time.Now().Add(s.config.WriteTimeout))
 		if err != nil {
 			return err
 		}
-		conn.SetWriteDeadline(time.Time{})
 		conn.SetReadDeadline(time.Now().Add(s.config.PongWait))
 		return nil
 	})
 
 	for {
+		if !s.waitIfPaused(client) {
+			break
+		}
+
 		_, msg, err := conn.ReadMessage()
 		if err != nil {
-			if websocket.IsUnexpectedCloseError(err) {
-				s.logger.Printf("Unexpected error from client %s: %v", client.ClientID, err)
+			if cause := client.cause(); cause != nil {
+				closeSent = true
+				disconnectErr = cause
+			} else if isProtocolError(err) {
+				closeSent = true
+				disconnectErr = fmt.Errorf("%w: %v", ErrProtocolViolation, err)
+				s.logger.Warnf("Client %s violated the protocol: %v", client.ClientID, err)
+			} else if websocket.IsUnexpectedCloseError(err) {
+				s.logger.Warnf("Unexpected error from client %s: %v", client.ClientID, err)
 			} else {
-				s.logger.Printf("Client %s closed connection: %v", client.ClientID, err)
+				s.logger.Infof("Client %s closed connection: %v", client.ClientID, err)
 			}
 			break
 		}
 
-		if s.callbacks.OnMessage != nil {
-			s.callbacks.OnMessage(client.ClientID, msg)
+		client.lastMessageAt.Store(time.Now().UnixNano())
+		received := client.messagesReceived.Add(1)
+		s.metrics.messagesReceived.Add(1)
+		s.metrics.bytesIn.Add(int64(len(msg)))
+
+		if limit := s.config.MaxMessagesPerConnection; limit > 0 && received > int64(limit) {
+			s.logger.Warnf("Client %s exceeded message quota of %d", client.ClientID, limit)
+			disconnectErr = fmt.Errorf("%w: %d messages", ErrMessageQuotaExceeded, limit)
+			closeCode, closeReason = websocket.ClosePolicyViolation, "message quota exceeded"
+			break
+		}
+
+		if err := s.allowMessage(client); err != nil {
+			if s.config.RateLimitPolicy == RateLimitDisconnect {
+				disconnectErr = err
+				closeCode, closeReason = websocket.ClosePolicyViolation, "rate limit exceeded"
+				break
+			}
+			continue
+		}
+
+		if s.recordPingEcho(client.ClientID, msg) {
+			continue
+		}
+
+		if s.isDuplicate(client.ClientID, msg) {
+			s.logger.Debugf("Dropping duplicate message from client %s", client.ClientID)
+			continue
+		}
+
+		if err := s.validateMessage(client, msg); err != nil {
+			if s.config.ValidationPolicy == ValidationDisconnect {
+				disconnectErr = err
+				closeCode, closeReason = websocket.CloseInvalidFramePayloadData, "invalid message"
+				break
+			}
+			continue
+		}
+
+		if err := s.safeHandleMessage(client, msg); err != nil {
+			disconnectErr = err
+			closeCode, closeReason = websocket.CloseInternalServerErr, "internal error"
+			break
 		}
 	}
 }
 
-func (s *Server) Broadcast(msg interface{}) {
-	var wg sync.WaitGroup
-	sem := make(chan struct{}, 100)
+func (s *Server) watchIdle(client *Client) {
+	timer := time.NewTimer(s.config.IdleTimeout)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-client.ctx.Done():
+			return
+		case <-timer.C:
+			idle := time.Since(time.Unix(0, client.lastMessageAt.Load()))
+			if idle >= s.config.IdleTimeout {
+				s.logger.Infof("Client %s idle for %v, disconnecting", client.ClientID, idle)
+				s.closeWithCause(client, websocket.CloseNormalClosure, "idle timeout", fmt.Errorf("%w after %v", ErrIdleTimeout, idle.Round(time.Millisecond)))
+				return
+			}
+			timer.Reset(s.config.IdleTimeout - idle)
+		}
+	}
+}
+
+func (s *Server) handleMessage(client *Client, msg []byte) {
+	s.applyMiddleware(func(clientID string, msg []byte) {
+		s.deliver(client, msg)
+	})(client.ClientID, msg)
+}
+
+func (s *Server) deliver(client *Client, msg []byte) {
+	if s.dispatchJSON(client.ClientID, msg) {
+		return
+	}
+	if s.callbacks.OnMessage == nil && s.callbacks.OnMessageCtx == nil {
+		return
+	}
+
+	start := time.Now()
+	if s.callbacks.OnMessage != nil {
+		s.callbacks.OnMessage(client.ClientID, msg)
+	}
+	if s.callbacks.OnMessageCtx != nil {
+		s.callbacks.OnMessageCtx(client.ctx, client.ClientID, msg)
+	}
+	if s.callbacks.OnMessageTiming != nil {
+		s.callbacks.OnMessageTiming(client.ClientID, time.Since(start))
+	}
+}
+
+// Broadcast and Send are safe for concurrent use. Every data frame for a
+// client is written by that client's writer goroutine, so concurrent callers
+// can never interleave partial frames on the wire.
+func (s *Server) Broadcast(msg interface{}) BroadcastResult {
+	return s.broadcast(msg, nil)
+}
+
+func (s *Server) BroadcastOlderThan(age time.Duration, msg interface{}) BroadcastResult {
+	return s.broadcast(msg, func(c *Client) bool {
+		return time.Since(c.connectedAt) > age
+	})
+}
+
+func (s *Server) BroadcastWhere(pred func(clientID string, data ClientInfo) bool, msg interface{}) int {
+	result := s.broadcast(msg, func(c *Client) bool {
+		return pred(c.ClientID, c.info())
+	})
+	return result.Enqueued
+}
+
+func (s *Server) SetClientTopics(clientID string, topics []string) error {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]struct{}, len(topics))
+	for _, topic := range topics {
+		set[topic] = struct{}{}
+	}
+
+	client.stateMu.Lock()
+	client.topics = set
+	client.stateMu.Unlock()
+	return nil
+}
+
+func (s *Server) BroadcastTopic(topic string, msg interface{}) BroadcastResult {
+	return s.broadcast(msg, func(c *Client) bool {
+		c.stateMu.RLock()
+		defer c.stateMu.RUnlock()
+		_, ok := c.topics[topic]
+		return ok
+	})
+}
+
+func (s *Server) broadcast(msg interface{}, filter func(c *Client) bool) BroadcastResult {
+	msg, ok := s.transformBroadcast(msg)
+	if !ok {
+		return BroadcastResult{}
+	}
+	return s.broadcastMessage(msg, filter, false)
+}
+
+func (s *Server) broadcastMessage(msg interface{}, filter func(c *Client) bool, wait bool) BroadcastResult {
+	payload, deadline := unwrapDeadline(msg)
+	return s.broadcastEncoded(payload, payload, deadline, filter, wait)
+}
+
+// broadcastEncoded sends wire as JSON and reports payload, the message the
+// caller asked to send, to OnUndeliverable and OnSendError.
+func (s *Server) broadcastEncoded(wire, payload interface{}, deadline time.Time, filter func(c *Client) bool, wait bool) BroadcastResult {
+	data, err := json.Marshal(wire)
+	if err != nil {
+		s.logger.Errorf("Broadcast encode error: %v", err)
+		if s.callbacks.OnError != nil {
+			s.callbacks.OnError(err)
+		}
+		return BroadcastResult{}
+	}
+	return s.broadcastFrame(websocket.TextMessage, data, deadline, payload, filter, wait)
+}
+
+func (s *Server) BroadcastBytes(messageType int, data []byte) BroadcastResult {
+	return s.broadcastFrame(messageType, data, time.Time{}, data, nil, false)
+}
+
+func (s *Server) BroadcastBinaryFunc(build func(clientID string) ([]byte, bool)) BroadcastResult {
+	var result BroadcastResult
+	s.metrics.broadcastCount.Add(1)
 
 	s.clients.Range(func(key, value any) bool {
 		client, ok := value.(*Client)
@@ -245,67 +787,253 @@ func (s *Server) Broadcast(msg interface{}) {
 			return true
 		}
 
+		data, ok := build(client.ClientID)
+		if !ok {
+			return true
+		}
+
+		result.add(s.enqueue(client, &outbound{
+			messageType: websocket.BinaryMessage,
+			data:        data,
+			msg:         data,
+		}))
+		return true
+	})
+	return result
+}
+
+// broadcastFrame prepares data once and queues it for every client passing
+// filter. With wait set it blocks until each queue has room instead of
+// applying SlowClientPolicy, using at most maxBroadcastWaiters goroutines.
+func (s *Server) broadcastFrame(messageType int, data []byte, deadline time.Time, msg interface{}, filter func(c *Client) bool, wait bool) BroadcastResult {
+	var (
+		result BroadcastResult
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+		sem    chan struct{}
+	)
+	if wait {
+		sem = make(chan struct{}, maxBroadcastWaiters)
+	}
+
+	prepared, err := s.prepare(messageType, data)
+	if err != nil {
+		s.logger.Errorf("Broadcast prepare error: %v", err)
+		if s.callbacks.OnError != nil {
+			s.callbacks.OnError(err)
+		}
+		return result
+	}
+	s.metrics.broadcastCount.Add(1)
+
+	s.clients.Range(func(key, value any) bool {
+		client, ok := value.(*Client)
+		if !ok || client == nil {
+			return true
+		}
+		if filter != nil && !filter(client) {
+			return true
+		}
+
+		item := &outbound{
+			messageType: messageType,
+			data:        data,
+			prepared:    prepared,
+			deadline:    deadline,
+			msg:         msg,
+		}
+		if !wait {
+			result.add(s.enqueue(client, item))
+			return true
+		}
+
 		sem <- struct{}{}
 		wg.Add(1)
-
-		go func(c *Client) {
+		go func() {
 			defer func() {
 				<-sem
 				wg.Done()
 			}()
-
-			c.mu.Lock()
-			defer c.mu.Unlock()
-			c.wsConn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
-			if err := c.wsConn.WriteJSON(msg); err != nil {
-				s.logger.Printf("Broadcast error to client %s: %v", c.ClientID, err)
-				s.closeConnection(c.ClientID, c.wsConn, "client disconnected due to error")
-				if s.callbacks.OnDisconnect != nil {
-					s.callbacks.OnDisconnect(c.ClientID, fmt.Errorf("client disconnected due to error: %v", err))
-				}
-			} else {
-				c.wsConn.SetWriteDeadline(time.Time{})
-			}
-		}(client)
+			err := s.pushWait(client, item)
+			mu.Lock()
+			result.add(err)
+			mu.Unlock()
+		}()
 		return true
 	})
 	wg.Wait()
+	return result
+}
+
+// BroadcastSync waits for room in every client's send queue instead of
+// applying SlowClientPolicy. Clients that disconnect while it waits are
+// skipped and not counted.
+func (s *Server) BroadcastSync(msg interface{}) int {
+	msg, ok := s.transformBroadcast(msg)
+	if !ok {
+		return 0
+	}
+	return s.broadcastMessage(msg, nil, true).Enqueued
 }
 
 func (s *Server) Send(clientID string, msg interface{}) error {
+	return <-s.SendAsync(clientID, msg)
+}
+
+// SendAsync enqueues msg on the client's writer and returns a channel that
+// yields the write result once and is then closed. Callers may ignore it.
+func (s *Server) SendAsync(clientID string, msg interface{}) <-chan error {
+	return s.sendAsync(clientID, msg, nil)
+}
+
+// SendWithDeadline replaces WriteTimeout for this message with an absolute
+// write deadline. A zero deadline lets the write block indefinitely.
+func (s *Server) SendWithDeadline(clientID string, msg interface{}, deadline time.Time) error {
+	return <-s.sendAsync(clientID, msg, func(item *outbound) {
+		item.writeDeadline = deadline
+		item.overrideWriteDeadline = true
+	})
+}
+
+func (s *Server) sendAsync(clientID string, msg interface{}, setup func(item *outbound)) <-chan error {
+	done := make(chan error, 1)
+
+	client, item, err := s.enqueueMessage(clientID, msg, setup)
+	if err != nil {
+		done <- err
+		close(done)
+		return done
+	}
+
+	go func() {
+		defer close(done)
+		select {
+		case err := <-item.result:
+			done <- err
+		case <-client.ctx.Done():
+			done <- ErrClientNotActive
+		}
+	}()
+	return done
+}
+
+func (s *Server) enqueueMessage(clientID string, msg interface{}, setup func(item *outbound)) (*Client, *outbound, error) {
+	client, err := s.getClient(clientID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	payload, deadline := unwrapDeadline(msg)
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return nil, nil, fmt.Errorf("encode message for client %s: %w", clientID, err)
+	}
+
+	item := &outbound{
+		messageType: websocket.TextMessage,
+		data:        data,
+		deadline:    deadline,
+		msg:         payload,
+		result:      make(chan error, 1),
+	}
+	if setup != nil {
+		setup(item)
+	}
+	if err := s.enqueue(client, item); err != nil && !errors.Is(err, ErrMessageDropped) {
+		return nil, nil, err
+	}
+	return client, item, nil
+}
+
+func (s *Server) undeliverable(clientID string, msg interface{}) {
+	if s.callbacks.OnUndeliverable != nil {
+		s.callbacks.OnUndeliverable(clientID, msg)
+	}
+}
+
+// ForEachClient calls fn for each connected client until fn returns false.
+func (s *Server) ForEachClient(fn func(clientID string) bool) {
+	s.clients.Range(func(key, _ any) bool {
+		clientID, ok := key.(string)
+		if !ok {
+			return true
+		}
+		return fn(clientID)
+	})
+}
+
+func (s *Server) getClient(clientID string) (*Client, error) {
 	value, ok := s.clients.Load(clientID)
 	if !ok {
-		return fmt.Errorf("client not found: %s", clientID)
+		return nil, fmt.Errorf("client not found: %s", clientID)
 	}
 
 	client, ok := value.(*Client)
 	if !ok || client == nil {
-		return fmt.Errorf("client cast failed or is nil: %s", clientID)
+		return nil, fmt.Errorf("client cast failed or is nil: %s", clientID)
 	}
+	return client, nil
+}
 
-	client.mu.Lock()
-	defer client.mu.Unlock()
-
-	client.wsConn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
-	if err := client.wsConn.WriteJSON(msg); err != nil {
-		s.logger.Printf("Send error to client %s: %v", clientID, err)
-		s.closeConnection(clientID, client.wsConn, "client disconnected due to error")
-		return fmt.Errorf("write to client %s failed: %w", clientID, err)
-	}
-	client.wsConn.SetWriteDeadline(time.Time{})
-	return nil
+func (s *Server) closeConnection(clientID string, conn wsConn, reason string) {
+	s.closeConnectionWithCode(clientID, conn, websocket.CloseNormalClosure, reason)
 }
 
-func (s *Server) closeConnection(clientID string, conn *websocket.Conn, reason string) {
-	closeMsg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, reason)
-	conn.SetWriteDeadline(time.Now().Add(s.config.WriteTimeout))
-	_ = conn.WriteMessage(websocket.CloseMessage, closeMsg)
+func (s *Server) closeConnectionWithCode(clientID string, conn wsConn, code int, reason string) {
+	closeMsg := websocket.FormatCloseMessage(code, reason)
+	_ = conn.WriteControl(websocket.CloseMessage, closeMsg, time.Now().Add(s.config.WriteTimeout))
 
 	time.Sleep(100 * time.Millisecond)
 
+	s.releaseConnection(clientID, conn)
+}
+
+// reserveConnection claims a connection slot before the upgrade, so
+// concurrent handshakes cannot all pass the MaxConnections check. Whoever
+// reserves a slot must hand it to serveConn or give it back.
+func (s *Server) reserveConnection() error {
+	for {
+		current := s.metrics.currentConnections.Load()
+		if limit := s.maxConnections.Load(); limit > 0 && current >= limit {
+			return fmt.Errorf("%w: %d connections", ErrServerAtCapacity, limit)
+		}
+		if s.metrics.currentConnections.CompareAndSwap(current, current+1) {
+			return nil
+		}
+	}
+}
+
+// releaseConnection closes the socket without a close frame and forgets the
+// client, unless a newer connection has since registered under clientID.
+func (s *Server) releaseConnection(clientID string, conn wsConn) {
 	_ = conn.Close()
 
-	s.clients.Delete(clientID)
+	value, ok := s.clients.Load(clientID)
+	if !ok {
+		return
+	}
+	client, ok := value.(*Client)
+	if !ok || client.wsConn != conn {
+		return
+	}
+	if s.clients.CompareAndDelete(clientID, client) {
+		if client.cancel != nil {
+			client.cancel()
+		}
+		s.metrics.currentConnections.Add(-1)
+	}
+}
+
+// evict closes a connection that a newer one with the same client ID has
+// replaced in the registry. Its slot is freed here, since releaseConnection
+// will no longer find it.
+func (s *Server) evict(old *Client) {
+	s.metrics.currentConnections.Add(-1)
+	s.logger.Warnf("Client %s reconnected, closing its previous connection", old.ClientID)
+	go func() {
+		s.closeConnectionWithCode(old.ClientID, old.wsConn, websocket.ClosePolicyViolation, "replaced by a newer connection")
+		old.cancel()
+	}()
 }
 
 func (s *Server) Shutdown() {
@@ -320,7 +1048,7 @@ func (s *Server) Shutdown() {
 			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 			defer cancel()
 			if err := s.httpServer.Shutdown(ctx); err != nil {
-				s.logger.Printf("HTTP server shutdown failed: %v", err)
+				s.logger.Errorf("HTTP server shutdown failed: %v", err)
 			}
 		}
 
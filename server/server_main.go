@@ -34,7 +34,7 @@ func main() {
 		},
 	}
 
-	server := NewServer(config, callbacks, logger)
+	server := NewServer(config, callbacks, NewStdLogger(logger))
 
 	go func() {
 		if err := server.Start(); err != nil {
@@ -44,8 +44,7 @@ func main() {
 
 	go func() {
 		for {
-			server.clients.Range(func(key, _ any) bool {
-				clientID := key.(string)
+			server.ForEachClient(func(clientID string) bool {
 				server.Send(clientID, "Hello Client "+clientID)
 				return true
 			})
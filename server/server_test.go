@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// newTestServer serves s.handleWS on a loopback httptest server and returns
+// the ws:// URL clients should dial. configure may adjust the config before
+// the server is built.
+func newTestServer(t testing.TB, configure func(cfg *WsConfig), callbacks *WsCallback) (*Server, string) {
+	t.Helper()
+
+	cfg := NewWsConfig("", "/ws", []string{"*"})
+	cfg.WriteTimeout = 5 * time.Second
+	if configure != nil {
+		configure(cfg)
+	}
+	s := NewServer(cfg, callbacks, discardLogger())
+
+	ts := httptest.NewServer(http.HandlerFunc(s.handleWS))
+	t.Cleanup(func() {
+		s.Shutdown()
+		ts.Close()
+	})
+	return s, "ws" + strings.TrimPrefix(ts.URL, "http")
+}
+
+func discardLogger() Logger {
+	return NewStdLogger(log.New(io.Discard, "", 0))
+}
+
+func dialTestClient(t testing.TB, url, clientID string) *websocket.Conn {
+	t.Helper()
+
+	header := http.Header{}
+	if clientID != "" {
+		header.Set("Client-Id", clientID)
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, header)
+	if err != nil {
+		t.Fatalf("dial %s: %v", clientID, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// waitFor polls cond until it holds or the timeout passes.
+func waitFor(t testing.TB, timeout time.Duration, cond func() bool) {
+	t.Helper()
+
+	deadline := time.Now().Add(timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("condition not met before timeout")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func waitForClients(t testing.TB, s *Server, ids ...string) {
+	t.Helper()
+	waitFor(t, 2*time.Second, func() bool {
+		for _, id := range ids {
+			if _, ok := s.ClientInfo(id); !ok {
+				return false
+			}
+		}
+		return true
+	})
+}
+
+func readJSON(t *testing.T, conn *websocket.Conn, v any) {
+	t.Helper()
+
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	if err := conn.ReadJSON(v); err != nil {
+		t.Fatalf("read: %v", err)
+	}
+}
+
+func TestConcurrentSendAndBroadcast(t *testing.T) {
+	const (
+		goroutines = 100
+		perWorker  = 10
+	)
+	clientIDs := []string{"a", "b", "c"}
+
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.SendQueueSize = goroutines * perWorker
+	}, nil)
+
+	conns := make(map[string]*websocket.Conn)
+	for _, id := range clientIDs {
+		conns[id] = dialTestClient(t, url, id)
+	}
+	waitForClients(t, s, clientIDs...)
+
+	want := make(map[string]int)
+	for i := 0; i < goroutines; i++ {
+		for j := 0; j < perWorker; j++ {
+			if (i+j)%2 == 0 {
+				for _, id := range clientIDs {
+					want[id]++
+				}
+			} else {
+				want[clientIDs[(i+j)%len(clientIDs)]]++
+			}
+		}
+	}
+
+	var readers sync.WaitGroup
+	for id, conn := range conns {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for n := 0; n < want[id]; n++ {
+				conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+				_, data, err := conn.ReadMessage()
+				if err != nil {
+					t.Errorf("client %s: read %d of %d: %v", id, n, want[id], err)
+					return
+				}
+				var msg map[string]int
+				if err := json.Unmarshal(data, &msg); err != nil {
+					t.Errorf("client %s got a corrupt frame %q: %v", id, data, err)
+				}
+			}
+		}()
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < perWorker; j++ {
+				msg := map[string]int{"worker": i, "seq": j}
+				if (i+j)%2 == 0 {
+					if result := s.Broadcast(msg); result.Enqueued != len(clientIDs) {
+						t.Errorf("broadcast enqueued %d, want %d", result.Enqueued, len(clientIDs))
+					}
+					continue
+				}
+				id := clientIDs[(i+j)%len(clientIDs)]
+				if err := s.Send(id, msg); err != nil {
+					t.Errorf("send to %s: %v", id, err)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	readers.Wait()
+}
+
+func TestSendUnknownClient(t *testing.T) {
+	s, _ := newTestServer(t, nil, nil)
+
+	err := s.Send("missing", "hello")
+	if err == nil || !strings.Contains(err.Error(), "client not found") {
+		t.Fatalf("Send to unknown client = %v, want not found", err)
+	}
+}
+
+// awaitResult reads the single result from a SendAsync channel and checks
+// that the channel is closed after it.
+func awaitResult(t *testing.T, done <-chan error) error {
+	t.Helper()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("SendAsync result not delivered")
+	}
+	select {
+	case extra, ok := <-done:
+		if ok {
+			t.Fatalf("SendAsync delivered a second result %v", extra)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("SendAsync channel not closed after its result")
+	}
+	return err
+}
+
+func TestSendAsync(t *testing.T) {
+	s, url := newTestServer(t, nil, nil)
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	if err := awaitResult(t, s.SendAsync("a", "hello")); err != nil {
+		t.Fatalf("SendAsync = %v", err)
+	}
+	var got string
+	readJSON(t, conn, &got)
+	if got != "hello" {
+		t.Fatalf("client read %q", got)
+	}
+
+	if err := awaitResult(t, s.SendAsync("missing", "hello")); err == nil {
+		t.Fatal("SendAsync to an unknown client succeeded")
+	}
+	if err := awaitResult(t, s.SendAsync("a", make(chan int))); err == nil {
+		t.Fatal("SendAsync of an unencodable value succeeded")
+	}
+}
+
+func TestSendAsyncClientGoneBeforeWrite(t *testing.T) {
+	s := NewServer(NewWsConfig("", "/ws", []string{"*"}), nil, discardLogger())
+	client := addQueuedClient(s, "a", 1)
+
+	done := s.SendAsync("a", "hello")
+	client.cancel()
+	if err := awaitResult(t, done); !errors.Is(err, ErrClientNotActive) {
+		t.Fatalf("SendAsync = %v, want ErrClientNotActive", err)
+	}
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func (s *Server) HandleSignals(drainTimeout time.Duration) {
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	s.handleSignals(sigs, drainTimeout)
+}
+
+func (s *Server) handleSignals(sigs <-chan os.Signal, drainTimeout time.Duration) {
+	select {
+	case <-s.ctx.Done():
+		return
+	case sig := <-sigs:
+		s.logger.Infof("Received %v, draining connections (timeout %v)", sig, drainTimeout)
+	}
+
+	s.Drain()
+	if !s.waitForClients(drainTimeout) {
+		s.logger.Warnf("Drain timeout exceeded with %d clients still connected", s.metrics.currentConnections.Load())
+	}
+	s.Shutdown()
+}
+
+func (s *Server) waitForClients(timeout time.Duration) bool {
+	deadline := time.NewTimer(timeout)
+	defer deadline.Stop()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+
+	for s.metrics.currentConnections.Load() > 0 {
+		select {
+		case <-deadline.C:
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHandleSignalsDrainsOnSignal(t *testing.T) {
+	s, url := newTestServer(t, nil, nil)
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	sigs := make(chan os.Signal, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.handleSignals(sigs, 2*time.Second)
+	}()
+
+	sigs <- syscall.SIGTERM
+	waitFor(t, time.Second, s.IsDraining)
+	if _, _, err := websocket.DefaultDialer.Dial(url, nil); err == nil {
+		t.Fatal("new connection accepted while draining")
+	}
+
+	select {
+	case <-done:
+		t.Fatal("handleSignals returned while a client was still connected")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.Close()
+	select {
+	case <-done:
+	case <-time.After(2 * time.Second):
+		t.Fatal("handleSignals did not return once drained")
+	}
+	if s.ctx.Err() == nil {
+		t.Fatal("server not shut down after drain")
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"net/http"
+)
+
+var ErrClientCAsRequired = errors.New("RequireClientCert set without ClientCAs")
+
+// checkTLSConfig rejects a RequireClientCert config with no CA pool to verify
+// client certificates against, which would otherwise fall back to the system
+// roots and accept any publicly issued certificate.
+func (s *Server) checkTLSConfig() error {
+	if !s.config.RequireClientCert || s.config.ClientCAs != nil {
+		return nil
+	}
+	if s.config.TLSConfig != nil && s.config.TLSConfig.ClientCAs != nil {
+		return nil
+	}
+	return ErrClientCAsRequired
+}
+
+func (s *Server) tlsConfig() *tls.Config {
+	if !s.config.RequireClientCert {
+		return s.config.TLSConfig
+	}
+
+	cfg := &tls.Config{}
+	if s.config.TLSConfig != nil {
+		cfg = s.config.TLSConfig.Clone()
+	}
+	cfg.ClientAuth = tls.RequireAndVerifyClientCert
+	if s.config.ClientCAs != nil {
+		cfg.ClientCAs = s.config.ClientCAs
+	}
+	return cfg
+}
+
+func verifiedPeerCert(r *http.Request) *x509.Certificate {
+	if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 || len(r.TLS.VerifiedChains[0]) == 0 {
+		return nil
+	}
+	return r.TLS.VerifiedChains[0][0]
+}
+
+func verifiedCertSubject(r *http.Request) string {
+	if cert := verifiedPeerCert(r); cert != nil {
+		return cert.Subject.String()
+	}
+	return ""
+}
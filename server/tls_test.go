@@ -0,0 +1,120 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStartTLSRequiresClientCAs(t *testing.T) {
+	cfg := NewWsConfig("127.0.0.1:0", "/ws", []string{"*"})
+	cfg.RequireClientCert = true
+	s := NewServer(cfg, nil, discardLogger())
+
+	if err := s.StartTLS("", ""); !errors.Is(err, ErrClientCAsRequired) {
+		t.Fatalf("StartTLS = %v, want ErrClientCAsRequired", err)
+	}
+}
+
+// newClientCert returns a CA pool and a client certificate it signed for
+// commonName.
+func newClientCert(t *testing.T, commonName string) (*x509.CertPool, tls.Certificate) {
+	t.Helper()
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, err := x509.ParseCertificate(caDER)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: commonName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca, &key.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+	return pool, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestClientCertCommonNameIsClientID(t *testing.T) {
+	pool, cert := newClientCert(t, "device-42")
+
+	connected := make(chan string, 1)
+	cfg := NewWsConfig("", "/ws", []string{"*"})
+	cfg.RequireClientCert = true
+	cfg.ClientCAs = pool
+	s := NewServer(cfg, &WsCallback{
+		OnConnect: func(clientID string) { connected <- clientID },
+	}, discardLogger())
+
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(s.handleWS))
+	ts.TLS = s.tlsConfig()
+	ts.StartTLS()
+	t.Cleanup(func() {
+		s.Shutdown()
+		ts.Close()
+	})
+	url := "wss" + strings.TrimPrefix(ts.URL, "https")
+
+	dialer := websocket.Dialer{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	if _, _, err := dialer.Dial(url, nil); err == nil {
+		t.Fatal("dial without a client certificate succeeded")
+	}
+
+	dialer.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	conn, _, err := dialer.Dial(url, nil)
+	if err != nil {
+		t.Fatalf("dial with client certificate: %v", err)
+	}
+	defer conn.Close()
+
+	select {
+	case id := <-connected:
+		if id != "device-42" {
+			t.Fatalf("client ID = %q, want the certificate CommonName", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnConnect not called")
+	}
+}
@@ -0,0 +1,22 @@
+package main
+
+import "fmt"
+
+// transformBroadcast runs BroadcastTransform once for a broadcast. It
+// reports false, after notifying OnError, when the broadcast must be aborted.
+func (s *Server) transformBroadcast(msg interface{}) (interface{}, bool) {
+	if s.config.BroadcastTransform == nil {
+		return msg, true
+	}
+
+	transformed, err := s.config.BroadcastTransform(msg)
+	if err != nil {
+		err = fmt.Errorf("broadcast transform: %w", err)
+		s.logger.Errorf("%v", err)
+		if s.callbacks.OnError != nil {
+			s.callbacks.OnError(err)
+		}
+		return nil, false
+	}
+	return transformed, true
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestStartUnixRoundTrip(t *testing.T) {
+	socketPath := filepath.Join(t.TempDir(), "ws.sock")
+	connected := make(chan string, 1)
+	var s *Server
+	s = NewServer(NewWsConfig("", "/ws", []string{"*"}), &WsCallback{
+		OnConnect: func(clientID string) { connected <- clientID },
+		OnMessage: func(clientID string, msg []byte) { s.Send(clientID, "echo: "+string(msg)) },
+	}, discardLogger())
+
+	served := make(chan error, 1)
+	go func() { served <- s.StartUnix(socketPath) }()
+	t.Cleanup(s.Shutdown)
+
+	dialer := websocket.Dialer{
+		NetDial: func(network, addr string) (net.Conn, error) {
+			return net.Dial("unix", socketPath)
+		},
+	}
+	var conn *websocket.Conn
+	waitFor(t, 2*time.Second, func() bool {
+		var err error
+		conn, _, err = dialer.Dial("ws://unix/ws", http.Header{"Client-Id": {"local"}})
+		return err == nil
+	})
+	defer conn.Close()
+
+	select {
+	case id := <-connected:
+		if id != "local" {
+			t.Fatalf("OnConnect(%q)", id)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnConnect not called")
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte("ping"))
+	var got string
+	readJSON(t, conn, &got)
+	if got != "echo: ping" {
+		t.Fatalf("read %q over the unix socket", got)
+	}
+
+	s.Shutdown()
+	select {
+	case err := <-served:
+		if !errors.Is(err, http.ErrServerClosed) {
+			t.Fatalf("StartUnix = %v, want http.ErrServerClosed", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("StartUnix did not return after Shutdown")
+	}
+	if _, err := os.Stat(socketPath); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("socket file left behind: %v", err)
+	}
+}
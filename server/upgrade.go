@@ -0,0 +1,33 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+)
+
+const (
+	frameCapabilityHeader = "X-Frame-Capability"
+	protocolVersionHeader = "X-Protocol-Version"
+)
+
+var (
+	ErrServerDraining      = errors.New("server draining")
+	ErrServerAtCapacity    = errors.New("server at capacity")
+	ErrHeadersTooLarge     = errors.New("request header fields too large")
+	ErrClientCertRequired  = errors.New("client certificate required")
+	ErrClientIDUnavailable = errors.New("could not assign client ID")
+	ErrMissingClientID     = errors.New("missing client ID")
+)
+
+// rejectUpgrade answers a request that failed a pre-upgrade check and
+// reports it through OnUpgradeError.
+func (s *Server) rejectUpgrade(w http.ResponseWriter, r *http.Request, status int, err error) {
+	http.Error(w, err.Error(), status)
+	s.upgradeError(r, err)
+}
+
+func (s *Server) upgradeError(r *http.Request, err error) {
+	if s.callbacks.OnUpgradeError != nil {
+		s.callbacks.OnUpgradeError(r, err)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMaxHandshakeHeaderBytes(t *testing.T) {
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.MaxHandshakeHeaderBytes = 2048
+	}, nil)
+
+	header := http.Header{}
+	header.Set("Client-Id", "big")
+	header.Set("X-Padding", strings.Repeat("x", 4096))
+	_, resp, err := websocket.DefaultDialer.Dial(url, header)
+	if err == nil {
+		t.Fatal("handshake with oversized headers succeeded")
+	}
+	if resp == nil || resp.StatusCode != http.StatusRequestHeaderFieldsTooLarge {
+		t.Fatalf("handshake response %v, want 431", resp)
+	}
+	if _, ok := s.ClientInfo("big"); ok {
+		t.Fatal("rejected client was registered")
+	}
+
+	dialTestClient(t, url, "small")
+	waitForClients(t, s, "small")
+}
+
+func TestReserveConnectionHonorsLimitUnderContention(t *testing.T) {
+	cfg := NewWsConfig("", "/ws", []string{"*"})
+	cfg.MaxConnections = 5
+	s := NewServer(cfg, nil, discardLogger())
+	t.Cleanup(s.Shutdown)
+
+	var reserved atomic.Int64
+	var wg sync.WaitGroup
+	for range 50 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := s.reserveConnection(); err == nil {
+				reserved.Add(1)
+			} else if !errors.Is(err, ErrServerAtCapacity) {
+				t.Errorf("reserveConnection: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if n := reserved.Load(); n != 5 {
+		t.Fatalf("%d reservations succeeded, want 5", n)
+	}
+}
+
+func TestFailedUpgradeReleasesConnectionSlot(t *testing.T) {
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.MaxConnections = 1
+	}, nil)
+
+	// A plain GET passes the capacity check and then fails the upgrade.
+	resp, err := http.Get("http" + strings.TrimPrefix(url, "ws"))
+	if err != nil {
+		t.Fatalf("GET: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Fatalf("GET status = %d, want 400", resp.StatusCode)
+	}
+	if n := s.metrics.currentConnections.Load(); n != 0 {
+		t.Fatalf("currentConnections = %d after a failed upgrade, want 0", n)
+	}
+
+	dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+var ErrInvalidJSON = errors.New("message is not valid JSON")
+
+type ValidationPolicy int
+
+const (
+	ValidationDrop ValidationPolicy = iota
+	ValidationDisconnect
+)
+
+func JSONValidator() func(clientID string, msg []byte) error {
+	return func(clientID string, msg []byte) error {
+		if !json.Valid(msg) {
+			return ErrInvalidJSON
+		}
+		return nil
+	}
+}
+
+// validateMessage runs MessageValidator and reports a rejection to OnError.
+// The returned error is nil for valid messages; otherwise the read loop drops
+// the message or disconnects per ValidationPolicy.
+func (s *Server) validateMessage(client *Client, msg []byte) error {
+	if s.config.MessageValidator == nil {
+		return nil
+	}
+
+	verr := s.config.MessageValidator(client.ClientID, msg)
+	if verr == nil {
+		return nil
+	}
+
+	err := fmt.Errorf("invalid message from client %s: %w", client.ClientID, verr)
+	s.logger.Warnf("%v", err)
+	if s.callbacks.OnError != nil {
+		s.callbacks.OnError(err)
+	}
+	return err
+}
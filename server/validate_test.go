@@ -0,0 +1,71 @@
+package main
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestMessageValidatorDrops(t *testing.T) {
+	messages := make(chan string, 2)
+	errs := make(chan error, 2)
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.MessageValidator = JSONValidator()
+	}, &WsCallback{
+		OnMessage: func(clientID string, msg []byte) { messages <- string(msg) },
+		OnError:   func(err error) { errs <- err },
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"broken"`))
+	conn.WriteMessage(websocket.TextMessage, []byte(`{"ok":true}`))
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrInvalidJSON) {
+			t.Fatalf("OnError(%v), want ErrInvalidJSON", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("invalid message not reported")
+	}
+	select {
+	case got := <-messages:
+		if got != `{"ok":true}` {
+			t.Fatalf("OnMessage(%q), the invalid message got through", got)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("valid message not delivered after an invalid one")
+	}
+}
+
+func TestMessageValidatorDisconnects(t *testing.T) {
+	disconnected := make(chan error, 1)
+	s, url := newTestServer(t, func(cfg *WsConfig) {
+		cfg.MessageValidator = JSONValidator()
+		cfg.ValidationPolicy = ValidationDisconnect
+	}, &WsCallback{
+		OnMessage:    func(clientID string, msg []byte) { t.Errorf("OnMessage(%q)", msg) },
+		OnDisconnect: func(clientID string, err error) { disconnected <- err },
+	})
+	conn := dialTestClient(t, url, "a")
+	waitForClients(t, s, "a")
+
+	conn.WriteMessage(websocket.TextMessage, []byte("not json"))
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, _, err := conn.ReadMessage()
+	if !websocket.IsCloseError(err, websocket.CloseInvalidFramePayloadData) {
+		t.Fatalf("read after invalid message = %v, want close 1007", err)
+	}
+
+	select {
+	case err := <-disconnected:
+		if !errors.Is(err, ErrInvalidJSON) {
+			t.Fatalf("OnDisconnect(%v), want the validation error", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnDisconnect not called")
+	}
+}
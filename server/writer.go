@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+var (
+	ErrQueueFull       = errors.New("client send queue full")
+	ErrMessageDropped  = errors.New("message dropped from send queue")
+	ErrClientSlow      = errors.New("client disconnected: send queue full")
+	ErrClientNotActive = errors.New("client connection closed")
+)
+
+// maxBroadcastWaiters bounds the goroutines a blocking broadcast parks on
+// full client queues.
+const maxBroadcastWaiters = 100
+
+type SlowClientPolicy int
+
+const (
+	DisconnectSlow SlowClientPolicy = iota
+	DropOldest
+	DropNewest
+)
+
+type BroadcastResult struct {
+	Enqueued     int
+	Dropped      int
+	Disconnected int
+}
+
+func (r *BroadcastResult) add(err error) {
+	switch {
+	case err == nil:
+		r.Enqueued++
+	case errors.Is(err, ErrMessageDropped):
+		r.Enqueued++
+		r.Dropped++
+	case errors.Is(err, ErrQueueFull):
+		r.Dropped++
+	default:
+		r.Disconnected++
+	}
+}
+
+type outbound struct {
+	messageType int
+	data        []byte
+	prepared    *websocket.PreparedMessage
+	deadline    time.Time
+	msg         interface{}
+	priority    Priority
+	result      chan error
+
+	writeDeadline         time.Time
+	overrideWriteDeadline bool
+}
+
+func (o *outbound) resolve(err error) {
+	if o.result != nil {
+		o.result <- err
+	}
+}
+
+func (s *Server) enqueue(client *Client, item *outbound) error {
+	err := s.push(client, item)
+	if err != nil && !errors.Is(err, ErrMessageDropped) {
+		s.sendError(client.ClientID, item.msg, err)
+	}
+	return err
+}
+
+func (s *Server) push(client *Client, item *outbound) error {
+	if client.ctx.Err() != nil {
+		return ErrClientNotActive
+	}
+
+	queue := client.queue(item.priority)
+
+	select {
+	case queue <- item:
+		return nil
+	default:
+	}
+
+	switch s.config.SlowClientPolicy {
+	case DropNewest:
+		return ErrQueueFull
+	case DropOldest:
+		for {
+			select {
+			case queue <- item:
+				return ErrMessageDropped
+			default:
+			}
+			select {
+			case oldest := <-queue:
+				oldest.resolve(ErrMessageDropped)
+				s.undeliverable(client.ClientID, oldest.msg)
+			default:
+			}
+		}
+	default:
+		s.logger.Warnf("Client %s send queue full, disconnecting", client.ClientID)
+		go s.closeConnection(client.ClientID, client.wsConn, "send queue full")
+		return ErrClientSlow
+	}
+}
+
+// pushWait blocks until item fits in the client's queue instead of applying
+// SlowClientPolicy.
+func (s *Server) pushWait(client *Client, item *outbound) error {
+	if client.ctx.Err() != nil {
+		return ErrClientNotActive
+	}
+	select {
+	case client.queue(item.priority) <- item:
+		return nil
+	case <-client.ctx.Done():
+		return ErrClientNotActive
+	}
+}
+
+func (s *Server) writePump(client *Client) {
+	defer func() {
+		for _, queue := range []chan *outbound{client.sendHigh, client.send, client.sendLow} {
+			for drained := false; !drained; {
+				select {
+				case item := <-queue:
+					item.resolve(ErrClientNotActive)
+				default:
+					drained = true
+				}
+			}
+		}
+	}()
+
+	for turn := 0; ; turn++ {
+		item, ok := client.nextOutbound(turn)
+		if !ok {
+			return
+		}
+
+		err := s.writeTo(client, item)
+		item.resolve(err)
+
+		if errors.Is(err, ErrMessageExpired) {
+			s.undeliverable(client.ClientID, item.msg)
+		} else if err != nil {
+			s.logger.Errorf("Write error to client %s: %v", client.ClientID, err)
+			s.sendError(client.ClientID, item.msg, err)
+			s.closeConnection(client.ClientID, client.wsConn, "client disconnected due to error")
+			return
+		}
+	}
+}
+
+func (s *Server) sendError(clientID string, msg interface{}, err error) {
+	if s.callbacks.OnSendError != nil {
+		s.callbacks.OnSendError(clientID, msg, err)
+	}
+}
+
+func (s *Server) writeTo(client *Client, item *outbound) error {
+	client.mu.Lock()
+	defer client.mu.Unlock()
+
+	// The message deadline only decides whether the frame is still worth
+	// sending. Once a write starts it runs under the socket write timeout, so
+	// a nearly expired message cannot time out the connection mid-frame.
+	if !item.deadline.IsZero() && !time.Now().Before(item.deadline) {
+		return ErrMessageExpired
+	}
+
+	writeDeadline := time.Now().Add(s.config.WriteTimeout)
+	if item.overrideWriteDeadline {
+		writeDeadline = item.writeDeadline
+	}
+
+	client.wsConn.SetWriteDeadline(writeDeadline)
+	var err error
+	if item.prepared != nil {
+		err = client.wsConn.WritePreparedMessage(item.prepared)
+	} else {
+		err = client.wsConn.WriteMessage(item.messageType, item.data)
+	}
+	if err != nil {
+		return fmt.Errorf("write to client %s failed: %w", client.ClientID, err)
+	}
+	client.wsConn.SetWriteDeadline(time.Time{})
+	client.lastWriteAt.Store(time.Now().UnixNano())
+	s.metrics.bytesOut.Add(int64(len(item.data)))
+	return nil
+}
@@ -0,0 +1,69 @@
+package wstest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// NewEchoServer starts an in-process WebSocket server on a loopback port that
+// echoes every frame back with its original message type. It returns the
+// listener's host:port and a stop func that closes the listener and every
+// open connection. stop is also registered with t.Cleanup.
+func NewEchoServer(t testing.TB) (addr string, stop func()) {
+	t.Helper()
+
+	var (
+		mu    sync.Mutex
+		conns = make(map[*websocket.Conn]struct{})
+	)
+	upgrader := websocket.Upgrader{
+		CheckOrigin: func(r *http.Request) bool { return true },
+	}
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+
+		mu.Lock()
+		conns[conn] = struct{}{}
+		mu.Unlock()
+
+		defer func() {
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+			conn.Close()
+		}()
+
+		for {
+			messageType, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if err := conn.WriteMessage(messageType, msg); err != nil {
+				return
+			}
+		}
+	}))
+
+	var once sync.Once
+	stop = func() {
+		once.Do(func() {
+			mu.Lock()
+			for conn := range conns {
+				conn.Close()
+			}
+			mu.Unlock()
+			ts.Close()
+		})
+	}
+	t.Cleanup(stop)
+
+	return ts.Listener.Addr().String(), stop
+}
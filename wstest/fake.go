@@ -0,0 +1,270 @@
+package wstest
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// Message is a frame scripted for, or recorded by, a FakeConn.
+type Message struct {
+	Type int
+	Data []byte
+
+	// Prepared is set instead of Data for WritePreparedMessage calls.
+	Prepared *websocket.PreparedMessage
+}
+
+type scriptedRead struct {
+	msg Message
+	err error
+}
+
+// FakeConn stands in for *websocket.Conn in client and server unit tests.
+// Reads are served in order from frames queued with QueueRead, QueueClose
+// and QueueError; ReadMessage blocks until one is queued, the read deadline
+// passes, or the conn is closed. Every write, including control frames, is
+// recorded and available from Writes.
+type FakeConn struct {
+	reads chan scriptedRead
+	done  chan struct{}
+
+	mu            sync.Mutex
+	writes        []Message
+	closed        bool
+	readDeadline  time.Time
+	writeDeadline time.Time
+	readLimit     int64
+	subprotocol   string
+	pingHandler   func(appData string) error
+	pongHandler   func(appData string) error
+	closeHandler  func(code int, text string) error
+}
+
+func NewFakeConn() *FakeConn {
+	return &FakeConn{
+		reads: make(chan scriptedRead, 256),
+		done:  make(chan struct{}),
+	}
+}
+
+func (f *FakeConn) QueueRead(messageType int, data []byte) {
+	f.reads <- scriptedRead{msg: Message{Type: messageType, Data: data}}
+}
+
+// QueueClose makes the next read invoke the close handler and fail with a
+// *websocket.CloseError, as a close frame from the peer would.
+func (f *FakeConn) QueueClose(code int, text string) {
+	f.reads <- scriptedRead{
+		msg: Message{Type: websocket.CloseMessage, Data: websocket.FormatCloseMessage(code, text)},
+		err: &websocket.CloseError{Code: code, Text: text},
+	}
+}
+
+func (f *FakeConn) QueueError(err error) {
+	f.reads <- scriptedRead{err: err}
+}
+
+// Ping and Pong invoke the installed handlers as if the peer had sent the
+// corresponding control frame.
+func (f *FakeConn) Ping(appData string) error {
+	f.mu.Lock()
+	h := f.pingHandler
+	f.mu.Unlock()
+	if h == nil {
+		return f.WriteControl(websocket.PongMessage, []byte(appData), time.Time{})
+	}
+	return h(appData)
+}
+
+func (f *FakeConn) Pong(appData string) error {
+	f.mu.Lock()
+	h := f.pongHandler
+	f.mu.Unlock()
+	if h == nil {
+		return nil
+	}
+	return h(appData)
+}
+
+func (f *FakeConn) Writes() []Message {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Message(nil), f.writes...)
+}
+
+func (f *FakeConn) Closed() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.closed
+}
+
+func (f *FakeConn) ReadDeadline() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readDeadline
+}
+
+func (f *FakeConn) WriteDeadline() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.writeDeadline
+}
+
+func (f *FakeConn) ReadLimit() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.readLimit
+}
+
+func (f *FakeConn) SetSubprotocol(protocol string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.subprotocol = protocol
+}
+
+func (f *FakeConn) ReadMessage() (int, []byte, error) {
+	f.mu.Lock()
+	deadline := f.readDeadline
+	f.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case read := <-f.reads:
+		if read.msg.Type == websocket.CloseMessage {
+			f.mu.Lock()
+			h := f.closeHandler
+			f.mu.Unlock()
+			if h != nil {
+				ce := read.err.(*websocket.CloseError)
+				h(ce.Code, ce.Text)
+			}
+		}
+		if read.err != nil {
+			return 0, nil, read.err
+		}
+		return read.msg.Type, read.msg.Data, nil
+	case <-timeout:
+		return 0, nil, os.ErrDeadlineExceeded
+	case <-f.done:
+		return 0, nil, &websocket.CloseError{Code: websocket.CloseAbnormalClosure, Text: io.ErrUnexpectedEOF.Error()}
+	}
+}
+
+func (f *FakeConn) NextReader() (int, io.Reader, error) {
+	messageType, data, err := f.ReadMessage()
+	if err != nil {
+		return messageType, nil, err
+	}
+	return messageType, bytes.NewReader(data), nil
+}
+
+func (f *FakeConn) WriteMessage(messageType int, data []byte) error {
+	return f.record(Message{Type: messageType, Data: bytes.Clone(data)})
+}
+
+func (f *FakeConn) WritePreparedMessage(pm *websocket.PreparedMessage) error {
+	return f.record(Message{Prepared: pm})
+}
+
+func (f *FakeConn) WriteControl(messageType int, data []byte, deadline time.Time) error {
+	return f.record(Message{Type: messageType, Data: bytes.Clone(data)})
+}
+
+func (f *FakeConn) NextWriter(messageType int) (io.WriteCloser, error) {
+	f.mu.Lock()
+	closed := f.closed
+	f.mu.Unlock()
+	if closed {
+		return nil, websocket.ErrCloseSent
+	}
+	return &fakeWriter{conn: f, messageType: messageType}, nil
+}
+
+func (f *FakeConn) SetReadDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readDeadline = t
+	return nil
+}
+
+func (f *FakeConn) SetWriteDeadline(t time.Time) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.writeDeadline = t
+	return nil
+}
+
+func (f *FakeConn) SetReadLimit(limit int64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.readLimit = limit
+}
+
+func (f *FakeConn) SetPingHandler(h func(appData string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pingHandler = h
+}
+
+func (f *FakeConn) SetPongHandler(h func(appData string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pongHandler = h
+}
+
+func (f *FakeConn) SetCloseHandler(h func(code int, text string) error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closeHandler = h
+}
+
+func (f *FakeConn) Subprotocol() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.subprotocol
+}
+
+func (f *FakeConn) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !f.closed {
+		f.closed = true
+		close(f.done)
+	}
+	return nil
+}
+
+func (f *FakeConn) record(msg Message) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.closed {
+		return websocket.ErrCloseSent
+	}
+	f.writes = append(f.writes, msg)
+	return nil
+}
+
+type fakeWriter struct {
+	conn        *FakeConn
+	messageType int
+	buf         bytes.Buffer
+}
+
+func (w *fakeWriter) Write(p []byte) (int, error) {
+	return w.buf.Write(p)
+}
+
+func (w *fakeWriter) Close() error {
+	return w.conn.record(Message{Type: w.messageType, Data: w.buf.Bytes()})
+}